@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/davidrios/nvim-mindevc/setup"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+// Opens a session running the args from sessionArgs, which is called after
+// the devcontainer settings are merged into the config.
+func runAttach(cmd *cobra.Command, sessionArgs func() []string) {
+	devcontainer, err := loadDevcontainer()
+	if err != nil {
+		log.Fatal("Error loading dev container: ", err)
+	}
+
+	applyContainerFlags(cmd)
+
+	remote, err := target.FromDevcontainer(cmdConfig.Config, devcontainer)
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+
+	err = setup.Attach(cmdConfig.Config, devcontainer, remote, sessionArgs())
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		log.Fatal("Error: ", err)
+	}
+}
+
+var attachCmd = &cobra.Command{
+	Use:   "attach [-- <nvim args>...]",
+	Short: "Open neovim inside devcontainer",
+	Run: func(cmd *cobra.Command, args []string) {
+		runAttach(cmd, func() []string {
+			return append([]string{cmdConfig.Config.Neovim.Runscript}, args...)
+		})
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Open a login shell inside devcontainer",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAttach(cmd, func() []string {
+			return []string{"sh", "-c", setup.LoginShellScript}
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(attachCmd)
+	RootCmd.AddCommand(shellCmd)
+
+	addContainerFlags(attachCmd)
+	addContainerFlags(shellCmd)
+}
@@ -12,7 +12,7 @@ var remoteSetupCmd = &cobra.Command{
 	Use:   "remote-setup",
 	Short: "Setup procedure that runs inside the devcontainer",
 	Run: func(cmd *cobra.Command, args []string) {
-		err := setup.RemoteSetup(cmdConfig)
+		err := setup.RemoteSetup(cmdConfig, buildMode)
 		if err != nil {
 			log.Fatal("Error: ", err)
 		}
@@ -21,4 +21,12 @@ var remoteSetupCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(remoteSetupCmd)
+
+	addBuildModeFlags(remoteSetupCmd)
+
+	remoteSetupCmd.Flags().BoolVar(
+		&buildMode.Prebuilt,
+		"prebuilt",
+		false,
+		"Install the neovim build copied by setup, compiling only if it doesn't run")
 }
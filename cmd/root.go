@@ -10,6 +10,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/setup"
 )
 
 var RootCmd = &cobra.Command{
@@ -30,6 +31,9 @@ var configFile string
 var devcontainerFile string
 var verbose bool
 var showVersion bool
+var upDevcontainer bool
+var skipLifecycle bool
+var buildMode setup.BuildMode
 
 func init() {
 	cobra.OnInitialize(initConfig)
@@ -77,3 +81,71 @@ func initConfig() {
 		log.Fatalf("Error: %s", err)
 	}
 }
+
+// Loads the devcontainer file from the command line or config, and merges
+// its nvim-mindevc customizations into cmdConfig.
+func loadDevcontainer() (config.Devcontainer, error) {
+	var devcontainerFileLoc = devcontainerFile
+	if devcontainerFileLoc == "" {
+		devcontainerFileLoc = cmdConfig.Config.GetDevcontainerFilePath()
+	}
+
+	devcontainer, err := config.LoadDevcontainer(devcontainerFileLoc)
+	if err != nil {
+		return devcontainer, err
+	}
+
+	if err := cmdConfig.MergeDevcontainer(devcontainer); err != nil {
+		return devcontainer, err
+	}
+
+	return devcontainer, nil
+}
+
+func addContainerFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&upDevcontainer,
+		"up",
+		false,
+		"Start the compose services if they are not running")
+
+	cmd.Flags().BoolVar(
+		&skipLifecycle,
+		"skip-lifecycle",
+		false,
+		"Don't run the devcontainer lifecycle commands")
+}
+
+// Overrides the container settings with the flags given in the command line.
+func applyContainerFlags(cmd *cobra.Command) {
+	if cmd.Flags().Changed("up") {
+		cmdConfig.Viper.Set("container.up", upDevcontainer)
+		cmdConfig.Config.Container.Up = upDevcontainer
+	}
+	if cmd.Flags().Changed("skip-lifecycle") {
+		cmdConfig.Viper.Set("container.skip_lifecycle", skipLifecycle)
+		cmdConfig.Config.Container.SkipLifecycle = skipLifecycle
+	}
+}
+
+func addBuildModeFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&buildMode.Update,
+		"update",
+		false,
+		"Rebuild neovim if its tag points to a new commit upstream, like a new nightly")
+
+	cmd.Flags().BoolVar(
+		&buildMode.Rebuild,
+		"rebuild",
+		false,
+		"Download and rebuild neovim even if it didn't change")
+
+	cmd.Flags().BoolVar(
+		&buildMode.Rollback,
+		"rollback",
+		false,
+		"Restore the neovim build replaced by the last update or rebuild")
+
+	cmd.MarkFlagsMutuallyExclusive("update", "rebuild", "rollback")
+}
@@ -7,27 +7,40 @@ import (
 
 	"github.com/davidrios/nvim-mindevc/config"
 	"github.com/davidrios/nvim-mindevc/setup"
+	"github.com/davidrios/nvim-mindevc/target"
 )
 
 var cmdDevcontainer config.Devcontainer
 var skipSelfBinary bool
+var buildOnHost bool
 
 var setupCmd = &cobra.Command{
 	Use:   "setup",
 	Short: "Setup neovim inside devcontainer",
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
-		var devcontainerFileLoc = devcontainerFile
-		if devcontainerFileLoc == "" {
-			devcontainerFileLoc = cmdConfig.Config.GetDevcontainerFilePath()
+		cmdDevcontainer, err = loadDevcontainer()
+		if err != nil {
+			log.Fatal("Error loading dev container: ", err)
+		}
+
+		applyContainerFlags(cmd)
+
+		if cmd.Flags().Changed("build-on-host") {
+			cmdConfig.Viper.Set("neovim.build.on_host", buildOnHost)
+			cmdConfig.Config.Neovim.Build.OnHost = buildOnHost
 		}
 
-		cmdDevcontainer, err = config.LoadDevcontainer(devcontainerFileLoc)
+		remote, err := target.FromDevcontainer(cmdConfig.Config, cmdDevcontainer)
 		if err != nil {
-			log.Fatal("Error loading dev container: ", err)
+			log.Fatal("Error: ", err)
 		}
 
-		err = setup.Setup(cmdConfig, cmdDevcontainer, skipSelfBinary)
+		err = setup.Setup(cmdConfig, cmdDevcontainer, remote, setup.SetupOptions{
+			SkipSelfBinary: skipSelfBinary,
+			Verbose:        verbose,
+			BuildMode:      buildMode,
+		})
 		if err != nil {
 			log.Fatal("Error: ", err)
 		}
@@ -42,4 +55,13 @@ func init() {
 		"skip-self", "S",
 		false,
 		"Don't use self binary on remote container even if os/architecture matches")
+
+	setupCmd.Flags().BoolVar(
+		&buildOnHost,
+		"build-on-host",
+		false,
+		"Cross-compile neovim on the host instead of in the devcontainer")
+
+	addContainerFlags(setupCmd)
+	addBuildModeFlags(setupCmd)
 }
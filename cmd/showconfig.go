@@ -16,6 +16,10 @@ var showConfigCmd = &cobra.Command{
 	Use:   "show-config",
 	Short: "Show current configuration values.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := loadDevcontainer(); err != nil {
+			slog.Debug("not using devcontainer customizations", "error", err)
+		}
+
 		yamlData, err := yaml.Marshal(cmdConfig.Viper.AllSettings())
 		if err != nil {
 			return fmt.Errorf("Failed to marshal config to YAML: %w", err)
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/davidrios/nvim-mindevc/setup"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+var switchCmd = &cobra.Command{
+	Use:   "switch <tag>",
+	Short: "Switch the neovim version the runscript opens inside devcontainer",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		devcontainer, err := loadDevcontainer()
+		if err != nil {
+			log.Fatal("Error loading dev container: ", err)
+		}
+
+		remote, err := target.FromDevcontainer(cmdConfig.Config, devcontainer)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		err = setup.SwitchNeovim(cmdConfig.Config, remote, args[0])
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(switchCmd)
+}
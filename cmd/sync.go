@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/setup"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+var syncDryRun bool
+var syncStrategy string
+var syncWatch bool
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the neovim config to the devcontainer",
+	Run: func(cmd *cobra.Command, args []string) {
+		devcontainer, err := loadDevcontainer()
+		if err != nil {
+			log.Fatal("Error loading dev container: ", err)
+		}
+		if devcontainer.Spec.RemoteUser == "" {
+			log.Fatal("Error: remoteUser property from devcontainer file must not be empty")
+		}
+
+		options := setup.ConfigSyncOptions{
+			Strategy: cmdConfig.Config.Neovim.ConfigSync,
+			Mount:    cmdConfig.Config.Neovim.ConfigMount,
+			DryRun:   syncDryRun,
+		}
+		if cmd.Flags().Changed("strategy") {
+			options.Strategy = syncStrategy
+		}
+		if syncWatch {
+			if !setup.IsLocalConfigFolder(cmdConfig.Config.Neovim.ConfigURI) {
+				log.Fatal("Error: --watch needs neovim.config_uri to be a local folder")
+			}
+			if options.Strategy == setup.ConfigSyncBindSymlink {
+				log.Fatal("Error: --watch is not needed with ", setup.ConfigSyncBindSymlink)
+			}
+			// watching is asking for the changes to be pushed
+			if options.Strategy == setup.ConfigSyncSkip {
+				options.Strategy = setup.ConfigSyncMerge
+			}
+		}
+
+		remote, err := target.FromDevcontainer(cmdConfig.Config, devcontainer)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		remoteHome, err := remote.Home(devcontainer.Spec.RemoteUser)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		cacheDir, err := config.ExpandHome(cmdConfig.Config.CacheDir)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		configPath, cleanup, err := setup.NeovimConfigDir(cmdConfig.Config, cacheDir)
+		defer cleanup()
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		syncConfig := func() error {
+			changes, err := setup.SyncNeovimConfig(remote, configPath, remoteHome, devcontainer.Spec.RemoteUser, options)
+			if err != nil {
+				return err
+			}
+			for _, change := range changes {
+				fmt.Printf("%-6s %s\n", change.Action, change.Path)
+			}
+			if len(changes) == 0 && !syncWatch {
+				fmt.Println("nothing to sync")
+			}
+			return nil
+		}
+
+		if err := syncConfig(); err != nil {
+			log.Fatal("Error: ", err)
+		}
+
+		if syncWatch {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			stop := make(chan struct{})
+			go func() {
+				<-signals
+				close(stop)
+			}()
+
+			err := setup.WatchNeovimConfig(configPath, setup.ConfigWatchDebounce, stop, nil, syncConfig)
+			if err != nil {
+				log.Fatal("Error: ", err)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().BoolVarP(
+		&syncDryRun,
+		"dry-run", "n",
+		false,
+		"Only list the changes")
+
+	syncCmd.Flags().StringVar(
+		&syncStrategy,
+		"strategy",
+		"",
+		"How an existing config is updated, one of skip, overwrite, merge or bind-symlink (default from neovim.config_sync)")
+
+	syncCmd.Flags().BoolVarP(
+		&syncWatch,
+		"watch", "w",
+		false,
+		"Keep running and sync the config when it changes, with merge unless another strategy is set")
+
+	syncCmd.MarkFlagsMutuallyExclusive("dry-run", "watch")
+}
@@ -7,25 +7,15 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 const VERSION = "v0.0.6"
 
-type Devcontainer struct {
-	Spec struct {
-		Name              string
-		RemoteUser        string `mapstructure:"remoteUser"`
-		ContainerUser     string `mapstructure:"containerUser"`
-		DockerComposeFile string `mapstructure:"dockerComposeFile"`
-		Service           string `mapstructure:"service"`
-		WorkspaceFolder   string `mapstructure:"workspaceFolder"`
-	}
-	FilePath string
-}
-
 type ConfigToolSource string
 
 const (
@@ -95,12 +85,78 @@ type ConfigTool struct {
 
 type ConfigTools map[string]ConfigTool
 
+type ConfigNeovimBuild struct {
+	// One of debug, safe, fast or small
+	Mode string
+	// Zig target triple, like `x86_64-linux-musl`. Empty for the native one
+	Target string
+	// Extra zig build arguments, like `-Dfoo=bar`
+	Args []string
+	// Cross-compile on the host instead of in the target
+	OnHost bool `mapstructure:"on_host"`
+	// Install the compiler and libc headers with the system package manager
+	// to build against the system libc
+	AllowSystemPackages bool `mapstructure:"allow_system_packages"`
+}
+
+type ConfigNeovimPlugins struct {
+	// Install the plugins with a headless neovim at the end of the setup
+	Sync bool
+	// Arguments for the headless neovim
+	SyncArgs []string `mapstructure:"sync_args"`
+	// Install the plugins in lazy-lock.json from a cache on the host
+	Cache bool
+	// Repository urls by plugin name, for plugins not installed on the host
+	Urls map[string]string
+}
+
+type ConfigTreesitterParser struct {
+	Name string
+	// Url of a tar.gz archive with the grammar sources
+	Url  string
+	Hash string
+	// Folder of the grammar inside the archive, for repositories with more
+	// than one
+	Location string
+}
+
+type ConfigFile struct {
+	// Local path, `file://` or `https://` uri of a file or folder
+	Source string
+	// Path in the target, `~` is the home of the remote user
+	Target string
+	// Optional sha256 of an https source
+	Hash string
+	// Owner in the target, defaults to the remote user
+	Owner string
+	// Octal permissions like 0600, empty to keep the source ones
+	Mode string
+}
+
 type Config struct {
 	Neovim struct {
 		ConfigURI string `mapstructure:"config_uri"`
-		Tag       string
+		// sha256 of the config_uri archive, required for https archives
+		ConfigHash string `mapstructure:"config_hash"`
+		// How an existing config in the target is updated, one of skip,
+		// overwrite, merge or bind-symlink
+		ConfigSync string `mapstructure:"config_sync"`
+		// Where the host config is mounted in the target, for bind-symlink
+		ConfigMount string `mapstructure:"config_mount"`
+		Tag         string
+		// Optional sha256 of the source archive of the tag
+		Hash      string
 		Runscript string
+		// Other tags to install side by side with Tag
+		Versions []string
+		Build    ConfigNeovimBuild
+		Plugins  ConfigNeovimPlugins
+	}
+	Treesitter struct {
+		Parsers []ConfigTreesitterParser
 	}
+	// Other files and folders to copy to the target
+	Files            []ConfigFile
 	InstallTools     []string `mapstructure:"install_tools"`
 	DevcontainerFile string   `mapstructure:"devcontainer_file"`
 	Tools            ConfigTools
@@ -110,6 +166,12 @@ type Config struct {
 		Workdir     string
 		ExtraBashRc string `mapstructure:"extra_bash_rc"`
 	}
+	Container struct {
+		Cli           string
+		Up            bool
+		UpTimeout     time.Duration `mapstructure:"up_timeout"`
+		SkipLifecycle bool          `mapstructure:"skip_lifecycle"`
+	}
 
 	FilePath string `mapstructure:"-"`
 }
@@ -121,16 +183,47 @@ func (config *Config) GetDevcontainerFilePath() string {
 	return config.DevcontainerFile
 }
 
+// Expands `~` in path and resolves it relative to the folder of the config
+// file if it's not absolute.
+func (config *Config) ResolvePath(path string) (string, error) {
+	path, err := ExpandHome(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(config.FilePath), path)
+	}
+	return path, nil
+}
+
 func (config *Config) GetConfigURI() (*url.URL, error) {
 	return url.Parse(config.Neovim.ConfigURI)
 }
 
+// The neovim tags to install, Tag first.
+func (config *Config) NeovimTags() []string {
+	tags := []string{config.Neovim.Tag}
+	for _, tag := range config.Neovim.Versions {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// The script that runs the neovim of tag. Neovim.Runscript links to the one of
+// the active version.
+func (config *Config) NeovimRunscript(tag string) string {
+	return filepath.Join(filepath.Dir(config.Neovim.Runscript), "nvim-"+tag)
+}
+
 type ConfigViper struct {
 	Config Config
 	Viper  *viper.Viper
 }
 
 const ConfigFileBaseName = "nvim-mindevc"
+const DevcontainerCustomizationsKey = ConfigFileBaseName
 const DefaultConfigFile = "." + ConfigFileBaseName + ".yaml"
 
 const DefaultZigLink = "/opt/nvim-mindevc/bin/zig"
@@ -273,10 +366,30 @@ func LoadConfig(loadConfigFile string) (ConfigViper, error) {
 	})
 	configViperViper.SetDefault("install_tools", []string{"fd", "ripgrep", "gosu", "curl", "zig", "make"})
 	configViperViper.SetDefault("neovim.config_uri", "file://~/.config/nvim")
+	configViperViper.SetDefault("neovim.config_hash", "")
+	configViperViper.SetDefault("neovim.config_sync", "skip")
+	configViperViper.SetDefault("neovim.config_mount", "")
 	configViperViper.SetDefault("neovim.tag", "nightly")
+	configViperViper.SetDefault("neovim.hash", "")
 	configViperViper.SetDefault("neovim.runscript", "/opt/nvim-mindevc/bin/nvim")
+	configViperViper.SetDefault("neovim.versions", []string{})
+	configViperViper.SetDefault("neovim.build.mode", "fast")
+	configViperViper.SetDefault("neovim.build.target", "")
+	configViperViper.SetDefault("neovim.build.args", []string{})
+	configViperViper.SetDefault("neovim.build.on_host", false)
+	configViperViper.SetDefault("neovim.build.allow_system_packages", false)
+	configViperViper.SetDefault("neovim.plugins.sync", false)
+	configViperViper.SetDefault("neovim.plugins.sync_args", []string{"+Lazy! sync", "+qa"})
+	configViperViper.SetDefault("neovim.plugins.cache", false)
+	configViperViper.SetDefault("neovim.plugins.urls", map[string]string{})
+	configViperViper.SetDefault("treesitter.parsers", []ConfigTreesitterParser{})
+	configViperViper.SetDefault("files", []ConfigFile{})
 	configViperViper.SetDefault("remote.workdir", "/opt/nvim-mindevc")
 	configViperViper.SetDefault("cache_dir", "~/.cache/nvim-mindevc")
+	configViperViper.SetDefault("container.cli", "auto")
+	configViperViper.SetDefault("container.up", false)
+	configViperViper.SetDefault("container.up_timeout", "2m")
+	configViperViper.SetDefault("container.skip_lifecycle", false)
 
 	if loadConfigFile != "" {
 		configViperViper.SetConfigFile(loadConfigFile)
@@ -323,50 +436,52 @@ func LoadConfig(loadConfigFile string) (ConfigViper, error) {
 	}, nil
 }
 
-func LoadDevcontainer(loadDevcontainerFile string) (Devcontainer, error) {
-	var devcontainer Devcontainer
+// Merges the `customizations.nvim-mindevc` object of the devcontainer file
+// into the configuration. It takes precedence over config files, but not
+// over environment variables.
+func (configViper *ConfigViper) MergeDevcontainer(devcontainer Devcontainer) error {
+	customizations, ok := devcontainer.Spec.Customizations[DevcontainerCustomizationsKey]
+	if !ok {
+		return nil
+	}
 
-	var devcontainerViper = viper.New()
-	if loadDevcontainerFile != "" {
-		devcontainerViper.SetConfigFile(loadDevcontainerFile)
-		if err := devcontainerViper.ReadInConfig(); err != nil {
-			return Devcontainer{}, err
-		}
-		devcontainer.FilePath = loadDevcontainerFile
-	} else {
-		var devcontainerExists = false
-		var devcontainerFiles = []string{
-			filepath.Join(".devcontainer", "devcontainer.json"),
-			".devcontainer.json"}
-
-		for _, filePath := range devcontainerFiles {
-			devcontainerViper.SetConfigFile(filePath)
-			if err := devcontainerViper.ReadInConfig(); err == nil {
-				devcontainerExists = true
-				devcontainer.FilePath = filePath
-				break
-			}
-		}
+	customizationsMap, ok := customizations.(map[string]any)
+	if !ok {
+		return fmt.Errorf("customizations.%s in devcontainer file must be an object", DevcontainerCustomizationsKey)
+	}
+	slog.Debug("merging devcontainer customizations", "v", customizationsMap)
 
-		if !devcontainerExists {
-			return Devcontainer{}, fmt.Errorf("no devcontainer file found")
-		}
+	if err := configViper.Viper.MergeConfigMap(customizationsMap); err != nil {
+		return err
 	}
 
-	if err := devcontainerViper.Unmarshal(&devcontainer.Spec); err != nil {
-		return Devcontainer{}, err
+	filePath := configViper.Config.FilePath
+	var newConfig Config
+	if err := configViper.Viper.Unmarshal(&newConfig); err != nil {
+		return err
 	}
+	newConfig.FilePath = filePath
+
+	// tools are added to the existing ones instead of replacing them
+	if _, ok := customizationsMap["tools"]; ok {
+		tools := maps.Clone(configViper.Config.Tools)
+		maps.Copy(tools, newConfig.Tools)
+		configViper.Viper.Set("tools", tools)
+		newConfig.Tools = tools
+	}
+
+	configViper.Config = newConfig
 
-	return devcontainer, nil
+	return nil
 }
 
 func ExpandHome(pathstr string) (string, error) {
-	if pathstr[:2] == "~/" {
+	if pathstr == "~" || strings.HasPrefix(pathstr, "~/") {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return "", err
 		}
-		pathstr = filepath.Join(home, pathstr[2:])
+		pathstr = filepath.Join(home, pathstr[1:])
 	}
 
 	return pathstr, nil
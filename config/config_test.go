@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
 
 func TestConfigToolArchiveType_IsValid(t *testing.T) {
 	testTable := []struct {
@@ -37,3 +42,153 @@ func TestConfigToolArchiveType_IsTar(t *testing.T) {
 		})
 	}
 }
+
+func TestDevcontainer_LocalWorkspaceFolder(t *testing.T) {
+	testTable := []struct {
+		filePath string
+		want     string
+	}{
+		{filePath: "/src/project/.devcontainer.json", want: "/src/project"},
+		{filePath: "/src/project/.devcontainer/devcontainer.json", want: "/src/project"},
+		{filePath: "/src/project/.devcontainer/python/devcontainer.json", want: "/src/project"},
+		{filePath: "/src/project/devcontainer.json", want: "/src/project"},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.filePath, func(t *testing.T) {
+			devcontainer := Devcontainer{FilePath: tv.filePath}
+			got, err := devcontainer.LocalWorkspaceFolder()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tv.want {
+				t.Fatalf("expected %q, got %q", tv.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigViper_MergeDevcontainer(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte("neovim:\n  tag: v0.10.0\ninstall_tools: [zig]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configViper, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	devcontainer, err := ParseDevcontainer([]byte(`{
+		"customizations": {
+			"nvim-mindevc": {
+				"install_tools": ["fd", "mytool"],
+				"neovim": {"tag": "stable"},
+				"remote": {"extra_bash_rc": "export A=1"},
+				"tools": {"mytool": {"source": "archive"}},
+			},
+		},
+	}`), "/src/project/.devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := configViper.MergeDevcontainer(devcontainer); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	merged := configViper.Config
+	if !slices.Equal(merged.InstallTools, []string{"fd", "mytool"}) {
+		t.Errorf("unexpected install_tools %v", merged.InstallTools)
+	}
+	if merged.Neovim.Tag != "stable" {
+		t.Errorf("unexpected neovim tag %q", merged.Neovim.Tag)
+	}
+	if merged.Neovim.Runscript != "/opt/nvim-mindevc/bin/nvim" {
+		t.Errorf("expected defaults to be kept, got runscript %q", merged.Neovim.Runscript)
+	}
+	if merged.Remote.ExtraBashRc != "export A=1" {
+		t.Errorf("unexpected extra_bash_rc %q", merged.Remote.ExtraBashRc)
+	}
+	if _, ok := merged.Tools["mytool"]; !ok {
+		t.Errorf("expected extra tool to be added")
+	}
+	if _, ok := merged.Tools["zig"]; !ok {
+		t.Errorf("expected default tools to be kept")
+	}
+	if merged.FilePath != configFile {
+		t.Errorf("expected file path to be kept, got %q", merged.FilePath)
+	}
+}
+
+func TestConfigViper_MergeDevcontainer_Invalid(t *testing.T) {
+	configViper, err := LoadConfig(filepath.Join("..", "testdata", DefaultConfigFile))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	devcontainer, err := ParseDevcontainer([]byte(`{"customizations": {"nvim-mindevc": "x"}}`), "/src/.devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := configViper.MergeDevcontainer(devcontainer); err == nil {
+		t.Fatal("expected error for non object customizations")
+	}
+}
+
+func TestConfig_NeovimTags(t *testing.T) {
+	testTable := []struct {
+		name     string
+		tag      string
+		versions []string
+		want     []string
+	}{
+		{name: "only tag", tag: "nightly", want: []string{"nightly"}},
+		{name: "versions", tag: "nightly", versions: []string{"stable", "v0.10.4"}, want: []string{"nightly", "stable", "v0.10.4"}},
+		{name: "duplicates", tag: "stable", versions: []string{"nightly", "stable", "nightly"}, want: []string{"stable", "nightly"}},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var config Config
+			config.Neovim.Tag = tv.tag
+			config.Neovim.Versions = tv.versions
+			if got := config.NeovimTags(); !slices.Equal(got, tv.want) {
+				t.Fatalf("expected %v, got %v", tv.want, got)
+			}
+		})
+	}
+
+	var config Config
+	config.Neovim.Runscript = "/opt/nvim-mindevc/bin/nvim"
+	if got := config.NeovimRunscript("stable"); got != "/opt/nvim-mindevc/bin/nvim-stable" {
+		t.Fatalf("unexpected runscript %s", got)
+	}
+}
+
+func TestConfig_ResolvePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	testTable := []struct {
+		path string
+		want string
+	}{
+		{path: "~/.gitconfig", want: filepath.Join(home, ".gitconfig")},
+		{path: "/etc/inputrc", want: "/etc/inputrc"},
+		{path: "dotfiles/inputrc", want: "/src/project/dotfiles/inputrc"},
+		{path: "a", want: "/src/project/a"},
+		{path: "~", want: home},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.path, func(t *testing.T) {
+			config := Config{FilePath: "/src/project/.nvim-mindevc.yaml"}
+			got, err := config.ResolvePath(tv.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tv.want {
+				t.Fatalf("expected %s, got %s", tv.want, got)
+			}
+		})
+	}
+}
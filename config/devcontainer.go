@@ -0,0 +1,397 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type DevcontainerBuild struct {
+	Dockerfile string `json:"dockerfile"`
+	Context    string `json:"context"`
+}
+
+type DevcontainerMount struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Mounts can be either objects or strings in the `docker run --mount` format,
+// like "source=/a,target=/b,type=bind".
+func (mount *DevcontainerMount) UnmarshalJSON(data []byte) error {
+	var mountStr string
+	if err := json.Unmarshal(data, &mountStr); err != nil {
+		type plainMount DevcontainerMount
+		return json.Unmarshal(data, (*plainMount)(mount))
+	}
+
+	for part := range strings.SplitSeq(mountStr, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "type":
+			mount.Type = value
+		case "source", "src":
+			mount.Source = value
+		case "target", "destination", "dst":
+			mount.Target = value
+		}
+	}
+
+	return nil
+}
+
+// A list of strings that can also be written as a single string.
+type StringList []string
+
+func (stringList *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*stringList = StringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*stringList = list
+
+	return nil
+}
+
+// A devcontainer lifecycle command. Can be a string that runs in a shell, an
+// array of args, or an object of named commands of either form, which run in
+// parallel. Each command is kept as its args, keyed by name, or by an empty
+// name for the non object forms.
+type LifecycleCommand map[string][]string
+
+func lifecycleArgs(data json.RawMessage) ([]string, error) {
+	var shellCmd string
+	if err := json.Unmarshal(data, &shellCmd); err == nil {
+		return []string{"/bin/sh", "-c", shellCmd}, nil
+	}
+
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, fmt.Errorf("lifecycle command must be a string or an array of strings")
+	}
+
+	return args, nil
+}
+
+func (lifecycleCommand *LifecycleCommand) UnmarshalJSON(data []byte) error {
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(data, &named); err != nil {
+		args, err := lifecycleArgs(data)
+		if err != nil {
+			return err
+		}
+		*lifecycleCommand = LifecycleCommand{"": args}
+		return nil
+	}
+
+	*lifecycleCommand = make(LifecycleCommand, len(named))
+	for name, rawCommand := range named {
+		args, err := lifecycleArgs(rawCommand)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		(*lifecycleCommand)[name] = args
+	}
+
+	return nil
+}
+
+type Devcontainer struct {
+	Spec struct {
+		Name              string              `json:"name"`
+		RemoteUser        string              `json:"remoteUser"`
+		ContainerUser     string              `json:"containerUser"`
+		DockerComposeFile StringList          `json:"dockerComposeFile"`
+		Service           string              `json:"service"`
+		RunServices       []string            `json:"runServices"`
+		ShutdownAction    string              `json:"shutdownAction"`
+		WorkspaceFolder   string              `json:"workspaceFolder"`
+		Image             string              `json:"image"`
+		Build             DevcontainerBuild   `json:"build"`
+		RemoteEnv         map[string]string   `json:"remoteEnv"`
+		ContainerEnv      map[string]string   `json:"containerEnv"`
+		Mounts            []DevcontainerMount `json:"mounts"`
+		Features          map[string]any      `json:"features"`
+		Customizations    map[string]any      `json:"customizations"`
+		OnCreateCommand   LifecycleCommand    `json:"onCreateCommand"`
+		PostCreateCommand LifecycleCommand    `json:"postCreateCommand"`
+		PostStartCommand  LifecycleCommand    `json:"postStartCommand"`
+		PostAttachCommand LifecycleCommand    `json:"postAttachCommand"`
+	}
+	FilePath string
+}
+
+func (devcontainer *Devcontainer) IsCompose() bool {
+	return len(devcontainer.Spec.DockerComposeFile) > 0
+}
+
+const (
+	ShutdownActionNone          = "none"
+	ShutdownActionStopCompose   = "stopCompose"
+	ShutdownActionStopContainer = "stopContainer"
+)
+
+// The shutdownAction with the spec defaults applied: stopCompose for compose
+// devcontainers and stopContainer for the rest.
+func (devcontainer *Devcontainer) ShutdownAction() string {
+	if devcontainer.Spec.ShutdownAction != "" {
+		return devcontainer.Spec.ShutdownAction
+	}
+	if devcontainer.IsCompose() {
+		return ShutdownActionStopCompose
+	}
+	return ShutdownActionStopContainer
+}
+
+func (devcontainer *Devcontainer) AbsFilePath() (string, error) {
+	return filepath.Abs(devcontainer.FilePath)
+}
+
+// The folder the devcontainer belongs to, as the devcontainer CLI sees it:
+// the parent of the `.devcontainer` dir, or the dir containing a
+// `.devcontainer.json` file.
+func (devcontainer *Devcontainer) LocalWorkspaceFolder() (string, error) {
+	absPath, err := devcontainer.AbsFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	for dir := filepath.Dir(absPath); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == ".devcontainer" {
+			return filepath.Dir(dir), nil
+		}
+	}
+
+	return filepath.Dir(absPath), nil
+}
+
+// The workspace folder inside the container, defaults to
+// `/workspaces/<local folder name>` like the devcontainer CLI does, or `/`
+// for compose devcontainers as in the spec.
+func (devcontainer *Devcontainer) ContainerWorkspaceFolder() (string, error) {
+	if devcontainer.Spec.WorkspaceFolder != "" {
+		return devcontainer.Spec.WorkspaceFolder, nil
+	}
+	if devcontainer.IsCompose() {
+		return "/", nil
+	}
+
+	localFolder, err := devcontainer.LocalWorkspaceFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join("/workspaces", filepath.Base(localFolder)), nil
+}
+
+// Returns remoteEnv in `KEY=value` form, resolving `${containerEnv:...}`
+// references with the given container environment.
+func (devcontainer *Devcontainer) RemoteEnvList(containerEnv map[string]string) []string {
+	env := make([]string, 0, len(devcontainer.Spec.RemoteEnv))
+	for key, value := range devcontainer.Spec.RemoteEnv {
+		env = append(env, key+"="+SubstituteContainerEnv(value, containerEnv))
+	}
+	return env
+}
+
+var devcontainerVarRe = regexp.MustCompile(`\$\{([a-zA-Z]+)(?::([^}]*))?\}`)
+
+// Replaces devcontainer variables in value using resolve, which gets the
+// variable name and its argument (like `localEnv` and `HOME`). Variables that
+// resolve returns false for are kept as they are.
+func substituteVars(value string, resolve func(name string, arg string) (string, bool)) string {
+	return devcontainerVarRe.ReplaceAllStringFunc(value, func(match string) string {
+		groups := devcontainerVarRe.FindStringSubmatch(match)
+		if resolved, ok := resolve(groups[1], groups[2]); ok {
+			return resolved
+		}
+		return match
+	})
+}
+
+func envLookup(arg string, lookup func(string) (string, bool)) string {
+	name, defaultValue, _ := strings.Cut(arg, ":")
+	if value, ok := lookup(name); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func SubstituteContainerEnv(value string, containerEnv map[string]string) string {
+	return substituteVars(value, func(name string, arg string) (string, bool) {
+		if name != "containerEnv" {
+			return "", false
+		}
+		return envLookup(arg, func(key string) (string, bool) {
+			value, ok := containerEnv[key]
+			return value, ok
+		}), true
+	})
+}
+
+func substituteAll(value any, resolve func(name string, arg string) (string, bool)) any {
+	switch typed := value.(type) {
+	case string:
+		return substituteVars(typed, resolve)
+	case []any:
+		for idx, item := range typed {
+			typed[idx] = substituteAll(item, resolve)
+		}
+	case map[string]any:
+		for key, item := range typed {
+			typed[key] = substituteAll(item, resolve)
+		}
+	}
+	return value
+}
+
+// Converts JSON with comments and trailing commas, as accepted by
+// devcontainer.json, to plain JSON.
+func JsoncToJson(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+
+	for idx := 0; idx < len(data); idx++ {
+		char := data[idx]
+
+		if inString {
+			out = append(out, char)
+			if char == '\\' && idx+1 < len(data) {
+				idx++
+				out = append(out, data[idx])
+			} else if char == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case char == '"':
+			inString = true
+			out = append(out, char)
+		case char == '/' && idx+1 < len(data) && data[idx+1] == '/':
+			for idx < len(data) && data[idx] != '\n' {
+				idx++
+			}
+			if idx < len(data) {
+				out = append(out, '\n')
+			}
+		case char == '/' && idx+1 < len(data) && data[idx+1] == '*':
+			end := bytes.Index(data[idx+2:], []byte("*/"))
+			if end == -1 {
+				idx = len(data)
+			} else {
+				idx += end + 3
+			}
+		case char == '}' || char == ']':
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, char)
+		default:
+			out = append(out, char)
+		}
+	}
+
+	return out
+}
+
+func ParseDevcontainer(data []byte, filePath string) (Devcontainer, error) {
+	devcontainer := Devcontainer{FilePath: filePath}
+
+	var raw map[string]any
+	if err := json.Unmarshal(JsoncToJson(data), &raw); err != nil {
+		return Devcontainer{}, fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+
+	localFolder, err := devcontainer.LocalWorkspaceFolder()
+	if err != nil {
+		return Devcontainer{}, err
+	}
+
+	substituteAll(raw, func(name string, arg string) (string, bool) {
+		switch name {
+		case "localEnv", "env":
+			return envLookup(arg, os.LookupEnv), true
+		case "localWorkspaceFolder":
+			return localFolder, true
+		case "localWorkspaceFolderBasename":
+			return filepath.Base(localFolder), true
+		}
+		return "", false
+	})
+
+	// the container workspace folder can reference local variables, so it's
+	// only known after the first pass
+	if workspaceFolder, ok := raw["workspaceFolder"].(string); ok {
+		devcontainer.Spec.WorkspaceFolder = workspaceFolder
+	}
+	if composeFile, ok := raw["dockerComposeFile"]; ok {
+		// invalid values are reported when reading the whole spec
+		if data, err := json.Marshal(composeFile); err == nil {
+			_ = json.Unmarshal(data, &devcontainer.Spec.DockerComposeFile)
+		}
+	}
+	containerFolder, err := devcontainer.ContainerWorkspaceFolder()
+	if err != nil {
+		return Devcontainer{}, err
+	}
+
+	substituteAll(raw, func(name string, arg string) (string, bool) {
+		switch name {
+		case "containerWorkspaceFolder":
+			return containerFolder, true
+		case "containerWorkspaceFolderBasename":
+			return path.Base(containerFolder), true
+		}
+		return "", false
+	})
+
+	substituted, err := json.Marshal(raw)
+	if err != nil {
+		return Devcontainer{}, err
+	}
+
+	if err := json.Unmarshal(substituted, &devcontainer.Spec); err != nil {
+		return Devcontainer{}, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+
+	return devcontainer, nil
+}
+
+func LoadDevcontainer(loadDevcontainerFile string) (Devcontainer, error) {
+	devcontainerFiles := []string{
+		filepath.Join(".devcontainer", "devcontainer.json"),
+		".devcontainer.json"}
+
+	if loadDevcontainerFile != "" {
+		devcontainerFiles = []string{loadDevcontainerFile}
+	}
+
+	for _, filePath := range devcontainerFiles {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			if loadDevcontainerFile != "" {
+				return Devcontainer{}, err
+			}
+			continue
+		}
+
+		return ParseDevcontainer(data, filePath)
+	}
+
+	return Devcontainer{}, fmt.Errorf("no devcontainer file found")
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestJsoncToJson(t *testing.T) {
+	testTable := []struct {
+		name  string
+		jsonc string
+		want  string
+	}{
+		{name: "plain", jsonc: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "line comment", jsonc: "{\n// comment\n\"a\": 1 // other\n}", want: "{\n\n\"a\": 1 \n}"},
+		{name: "block comment", jsonc: `{/* a
+		b */"a": 1}`, want: `{"a": 1}`},
+		{name: "trailing commas", jsonc: "{\"a\": [1, 2,],\n}", want: "{\"a\": [1, 2]\n}"},
+		{name: "comment chars in string", jsonc: `{"a": "http://x/*y*/", "b": "q\"//"}`, want: `{"a": "http://x/*y*/", "b": "q\"//"}`},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			got := string(JsoncToJson([]byte(tv.jsonc)))
+			if got != tv.want {
+				t.Fatalf("expected %q, got %q", tv.want, got)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Fatalf("result is not valid json: %q", got)
+			}
+		})
+	}
+}
+
+func TestParseDevcontainer(t *testing.T) {
+	t.Setenv("NVIM_MINDEVC_TEST_VAR", "fromenv")
+
+	data := []byte(`{
+	// comments are allowed
+	"name": "${localWorkspaceFolderBasename}",
+	"image": "ubuntu:24.04",
+	"remoteUser": "${localEnv:NVIM_MINDEVC_TEST_VAR}",
+	"remoteEnv": {
+		"PATH": "${containerEnv:PATH}:/opt/nvim-mindevc/bin",
+		"MISSING": "${localEnv:NVIM_MINDEVC_MISSING_VAR:default}",
+		"WORKSPACE": "${containerWorkspaceFolder}",
+	},
+	"containerEnv": {"LOCAL": "${localWorkspaceFolder}"},
+	"mounts": [
+		"source=${localEnv:NVIM_MINDEVC_TEST_VAR},target=/data,type=bind",
+		{"source": "vol", "target": "/vol", "type": "volume"},
+	],
+	"features": {"ghcr.io/devcontainers/features/git:1": {}},
+	"customizations": {"nvim-mindevc": {"install_tools": ["fd"]}},
+}`)
+
+	devcontainer, err := ParseDevcontainer(data, "/src/project/.devcontainer/devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	spec := devcontainer.Spec
+	if spec.Name != "project" {
+		t.Errorf("unexpected name %q", spec.Name)
+	}
+	if spec.RemoteUser != "fromenv" {
+		t.Errorf("unexpected remoteUser %q", spec.RemoteUser)
+	}
+	if spec.RemoteEnv["MISSING"] != "default" {
+		t.Errorf("unexpected default value %q", spec.RemoteEnv["MISSING"])
+	}
+	if spec.RemoteEnv["WORKSPACE"] != "/workspaces/project" {
+		t.Errorf("unexpected container workspace folder %q", spec.RemoteEnv["WORKSPACE"])
+	}
+	if spec.ContainerEnv["LOCAL"] != "/src/project" {
+		t.Errorf("unexpected local workspace folder %q", spec.ContainerEnv["LOCAL"])
+	}
+	if spec.RemoteEnv["PATH"] != "${containerEnv:PATH}:/opt/nvim-mindevc/bin" {
+		t.Errorf("containerEnv should only be substituted later, got %q", spec.RemoteEnv["PATH"])
+	}
+
+	wantMounts := []DevcontainerMount{
+		{Type: "bind", Source: "fromenv", Target: "/data"},
+		{Type: "volume", Source: "vol", Target: "/vol"},
+	}
+	if !slices.Equal(spec.Mounts, wantMounts) {
+		t.Errorf("expected mounts %v, got %v", wantMounts, spec.Mounts)
+	}
+	if _, ok := spec.Features["ghcr.io/devcontainers/features/git:1"]; !ok {
+		t.Errorf("expected features to be kept, got %v", spec.Features)
+	}
+	if _, ok := spec.Customizations["nvim-mindevc"]; !ok {
+		t.Errorf("expected customizations to be kept, got %v", spec.Customizations)
+	}
+
+	env := devcontainer.RemoteEnvList(map[string]string{"PATH": "/usr/bin"})
+	if !slices.Contains(env, "PATH=/usr/bin:/opt/nvim-mindevc/bin") {
+		t.Errorf("expected containerEnv to be resolved, got %v", env)
+	}
+}
+
+func TestContainerWorkspaceFolder_Compose(t *testing.T) {
+	devcontainer, err := ParseDevcontainer(
+		[]byte(`{"dockerComposeFile": "compose.yaml", "service": "app", "remoteEnv": {"WORKSPACE": "${containerWorkspaceFolder}"}}`),
+		"/src/project/.devcontainer/devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	workspaceFolder, err := devcontainer.ContainerWorkspaceFolder()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if workspaceFolder != "/" {
+		t.Errorf("expected / as compose workspace folder, got %q", workspaceFolder)
+	}
+	if devcontainer.Spec.RemoteEnv["WORKSPACE"] != "/" {
+		t.Errorf("unexpected container workspace folder %q", devcontainer.Spec.RemoteEnv["WORKSPACE"])
+	}
+}
+
+func TestLoadDevcontainer_TestProjects(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "test_project", "*", ".devcontainer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test devcontainers found")
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			devcontainer, err := LoadDevcontainer(file)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if devcontainer.Spec.Service != filepath.Base(filepath.Dir(file)) {
+				t.Fatalf("unexpected service %q", devcontainer.Spec.Service)
+			}
+			if devcontainer.Spec.WorkspaceFolder != "/code" {
+				t.Fatalf("unexpected workspace folder %q", devcontainer.Spec.WorkspaceFolder)
+			}
+		})
+	}
+}
+
+func TestLifecycleCommand_UnmarshalJSON(t *testing.T) {
+	testTable := []struct {
+		name string
+		json string
+		want LifecycleCommand
+	}{
+		{name: "string", json: `"make install"`, want: LifecycleCommand{"": {"/bin/sh", "-c", "make install"}}},
+		{name: "array", json: `["make", "install"]`, want: LifecycleCommand{"": {"make", "install"}}},
+		{
+			name: "object",
+			json: `{"deps": "npm ci", "db": ["./migrate", "--yes"]}`,
+			want: LifecycleCommand{"deps": {"/bin/sh", "-c", "npm ci"}, "db": {"./migrate", "--yes"}},
+		},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var got LifecycleCommand
+			if err := json.Unmarshal([]byte(tv.json), &got); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tv.want) {
+				t.Fatalf("expected %v, got %v", tv.want, got)
+			}
+		})
+	}
+
+	var invalid LifecycleCommand
+	if err := json.Unmarshal([]byte(`{"a": 1}`), &invalid); err == nil {
+		t.Fatal("expected error for invalid command")
+	}
+}
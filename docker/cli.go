@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+)
+
+// Container CLI used to talk to the container engine. Engine is the binary for
+// single container operations (exec, cp, ps) and Compose the command prefix
+// for compose projects.
+type Cli struct {
+	Name    string
+	Engine  string
+	Compose []string
+	// podman-compose has no `cp` subcommand, copy with the engine instead
+	NoComposeCp bool
+}
+
+const CliAuto = "auto"
+
+var Clis = []Cli{
+	{Name: "docker", Engine: "docker", Compose: []string{"docker", "compose"}},
+	{Name: "podman", Engine: "podman", Compose: []string{"podman", "compose"}},
+	{Name: "podman-compose", Engine: "podman", Compose: []string{"podman-compose"}, NoComposeCp: true},
+	{Name: "nerdctl", Engine: "nerdctl", Compose: []string{"nerdctl", "compose"}},
+}
+
+var DefaultCli = Clis[0]
+
+// Whether the CLI can be used. Only the engine binary is checked unless
+// compose is needed.
+func (cli *Cli) isAvailable(compose bool) bool {
+	cmdArgs := []string{cli.Engine, "--version"}
+	if compose {
+		cmdArgs = append(slices.Clone(cli.Compose), "version")
+	}
+
+	if _, err := exec.LookPath(cmdArgs[0]); err != nil {
+		return false
+	}
+
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	if err := cmd.Run(); err != nil {
+		slog.Debug("container cli not usable", "cli", cli.Name, "error", err)
+		return false
+	}
+
+	return true
+}
+
+// Returns the CLI with the given name. With `auto` or an empty name, returns
+// the first available one in the order of Clis, with a working compose if
+// compose is set.
+func GetCli(name string, compose bool) (Cli, error) {
+	if name == "" || name == CliAuto {
+		for _, cli := range Clis {
+			if cli.isAvailable(compose) {
+				slog.Debug("detected container cli", "cli", cli.Name)
+				return cli, nil
+			}
+		}
+		if !compose {
+			return Cli{}, fmt.Errorf("no container cli found, tried docker, podman and nerdctl")
+		}
+		return Cli{}, fmt.Errorf("no container cli found, tried docker compose, podman compose, podman-compose and nerdctl compose")
+	}
+
+	for _, cli := range Clis {
+		if cli.Name == name {
+			return cli, nil
+		}
+	}
+
+	return Cli{}, fmt.Errorf("unknown container cli '%s'", name)
+}
@@ -8,6 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
@@ -23,8 +26,9 @@ type ComposeFileSpec struct {
 }
 
 type ComposeFile struct {
-	Spec     ComposeFileSpec
-	FilePath string
+	Spec      ComposeFileSpec
+	FilePaths []string
+	Cli       Cli
 }
 
 type ComposePsItem struct {
@@ -32,34 +36,134 @@ type ComposePsItem struct {
 	Image   string
 	Service string
 	State   string
+	Health  string
+}
+
+func (composeFile *ComposeFile) command(args ...string) *exec.Cmd {
+	cli := composeFile.Cli
+	if len(cli.Compose) == 0 {
+		cli = DefaultCli
+	}
+
+	cmdArgs := slices.Clone(cli.Compose[1:])
+	for _, filePath := range composeFile.FilePaths {
+		cmdArgs = append(cmdArgs, "-f", filePath)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmd := exec.Command(cli.Compose[0], cmdArgs...)
+	if len(composeFile.FilePaths) > 0 {
+		cmd.Dir = filepath.Dir(composeFile.FilePaths[0])
+	}
+	slog.Debug("cmdArgs", "v", cmd.Args)
+
+	return cmd
+}
+
+// The item format of `ps --format json` differs between CLIs: docker outputs
+// one object per line (or an array in older versions), podman-compose an
+// array of `podman ps` objects where the service is only in the labels.
+type rawPsItem struct {
+	ID      string
+	Image   string
+	Service string
+	State   json.RawMessage
+	Health  string
+	Status  string
+	Labels  json.RawMessage
+}
+
+// The labels of a ps item, docker prints them as a `k=v,k=v` string and
+// podman as an object.
+func parsePsLabels(raw json.RawMessage) map[string]string {
+	labels := make(map[string]string)
+	if len(raw) == 0 {
+		return labels
+	}
+
+	if err := json.Unmarshal(raw, &labels); err == nil {
+		return labels
+	}
+
+	var labelsStr string
+	if err := json.Unmarshal(raw, &labelsStr); err != nil {
+		return labels
+	}
+	for label := range strings.SplitSeq(labelsStr, ",") {
+		if key, value, ok := strings.Cut(label, "="); ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+func ParsePsOutput(output []byte) ([]ComposePsItem, error) {
+	output = bytes.TrimSpace(output)
+
+	var rawItems []rawPsItem
+	if len(output) > 0 && output[0] == '[' {
+		if err := json.Unmarshal(output, &rawItems); err != nil {
+			return nil, fmt.Errorf("error reading output: %w", err)
+		}
+	} else {
+		for lineBytes := range bytes.SplitSeq(output, []byte("\n")) {
+			lineBytes = bytes.TrimSpace(lineBytes)
+			if len(lineBytes) == 0 {
+				continue
+			}
+
+			var rawItem rawPsItem
+			if err := json.Unmarshal(lineBytes, &rawItem); err != nil {
+				return nil, fmt.Errorf("error reading output: %w", err)
+			}
+			rawItems = append(rawItems, rawItem)
+		}
+	}
+
+	items := make([]ComposePsItem, 0, len(rawItems))
+	for _, rawItem := range rawItems {
+		psItem := ComposePsItem{
+			ID:      rawItem.ID,
+			Image:   rawItem.Image,
+			Service: rawItem.Service,
+			Health:  rawItem.Health,
+		}
+		if psItem.Service == "" {
+			psItem.Service = parsePsLabels(rawItem.Labels)["com.docker.compose.service"]
+		}
+
+		// older podman versions report the state as a number
+		if err := json.Unmarshal(rawItem.State, &psItem.State); err != nil {
+			psItem.State = rawItem.Status
+		}
+
+		items = append(items, psItem)
+	}
+
+	return items, nil
 }
 
 func (composeFile *ComposeFile) Ps(serviceName string) (ComposePsItem, error) {
 	var servicePs ComposePsItem
-	cmd := exec.Command("docker", "compose", "ps", "-a", "--format", "json")
-	cmd.Dir = filepath.Dir(composeFile.FilePath)
+	cmd := composeFile.command("ps", "-a", "--format", "json")
 	output, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			slog.Debug("cmd error", "stderr", exitErr.Stderr)
 		}
-		return servicePs, fmt.Errorf("error executing docker compose: %w", err)
+		return servicePs, fmt.Errorf("error executing compose: %w", err)
 	}
-	slog.Debug("cmd output", "v", output[:200])
+	slog.Debug("cmd output", "v", string(output[:min(len(output), 200)]))
 
-	if len(output) == 0 {
-		return servicePs, fmt.Errorf("got empty compose output. try starting the compose project first")
+	items, err := ParsePsOutput(output)
+	if err != nil {
+		return servicePs, err
 	}
 
-	lines := bytes.SplitSeq(output, []byte("\n"))
-	for lineBytes := range lines {
-		lineBytes = bytes.TrimSpace(lineBytes)
-
-		var psItem ComposePsItem
-		if err := json.Unmarshal(lineBytes, &psItem); err != nil {
-			return servicePs, fmt.Errorf("error reading output: %w", err)
-		}
+	if len(items) == 0 {
+		return servicePs, fmt.Errorf("got empty compose output. try starting the compose project first, or use the --up option")
+	}
 
+	for _, psItem := range items {
 		if psItem.Service == serviceName {
 			return psItem, nil
 		}
@@ -69,7 +173,7 @@ func (composeFile *ComposeFile) Ps(serviceName string) (ComposePsItem, error) {
 }
 
 func (composeFile *ComposeFile) Exec(serviceName string, execParams ExecParams) (string, error) {
-	cmdArgs := []string{"compose", "exec"}
+	cmdArgs := []string{"exec"}
 	if execParams.Dettach {
 		cmdArgs = append(cmdArgs, "--detach")
 	}
@@ -82,7 +186,7 @@ func (composeFile *ComposeFile) Exec(serviceName string, execParams ExecParams)
 		cmdArgs = append(cmdArgs, "--privileged")
 	}
 	if !execParams.Tty {
-		cmdArgs = append(cmdArgs, "--no-TTY")
+		cmdArgs = append(cmdArgs, "-T")
 	}
 	if execParams.User != "" {
 		cmdArgs = append(cmdArgs, "--user", execParams.User)
@@ -92,19 +196,74 @@ func (composeFile *ComposeFile) Exec(serviceName string, execParams ExecParams)
 	}
 	cmdArgs = append(cmdArgs, serviceName)
 	cmdArgs = append(cmdArgs, execParams.Args...)
-	cmd := exec.Command("docker", cmdArgs...)
-	slog.Debug("cmdArgs", "v", cmd.Args)
-	cmd.Dir = filepath.Dir(composeFile.FilePath)
-	output, err := cmd.Output()
+	cmd := composeFile.command(cmdArgs...)
+	output, err := runExec(cmd, execParams, serviceName)
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			slog.Debug("cmd error", "stderr", exitErr.Stderr)
 		}
-		return "", fmt.Errorf("error executing docker compose: %w", err)
+		return "", fmt.Errorf("error executing compose: %w", err)
 	}
 	return string(output[:]), nil
 }
 
+func (composeFile *ComposeFile) Up(serviceNames []string) error {
+	cmdArgs := append([]string{"up", "--detach"}, serviceNames...)
+	cmd := composeFile.command(cmdArgs...)
+	_, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return fmt.Errorf("error executing compose: %w", err)
+	}
+	return nil
+}
+
+func (composeFile *ComposeFile) Stop(serviceNames []string) error {
+	cmdArgs := append([]string{"stop"}, serviceNames...)
+	cmd := composeFile.command(cmdArgs...)
+	_, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return fmt.Errorf("error executing compose: %w", err)
+	}
+	return nil
+}
+
+func (psItem *ComposePsItem) IsReady() bool {
+	return psItem.State == "running" && (psItem.Health == "" || psItem.Health == "healthy")
+}
+
+// Waits until the service container is running, and healthy if it has a
+// health check.
+func (composeFile *ComposeFile) WaitRunning(serviceName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		psItem, err := composeFile.Ps(serviceName)
+		if err == nil {
+			if psItem.IsReady() {
+				return nil
+			}
+			if psItem.Health == "unhealthy" {
+				return fmt.Errorf("service '%s' is unhealthy", serviceName)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("timed out waiting for service '%s' to be running: %w", serviceName, err)
+			}
+			return fmt.Errorf("timed out waiting for service '%s' to be running, state: '%s'", serviceName, psItem.State)
+		}
+
+		slog.Debug("waiting for service", "service", serviceName, "state", psItem.State, "health", psItem.Health, "error", err)
+		time.Sleep(time.Second)
+	}
+}
+
 type CpToServiceOptions struct {
 	All        bool
 	Archive    bool
@@ -114,7 +273,16 @@ type CpToServiceOptions struct {
 }
 
 func (composeFile *ComposeFile) CpToService(serviceName string, src string, dest string, options CpToServiceOptions) error {
-	cmdArgs := []string{"compose", "cp"}
+	if composeFile.Cli.NoComposeCp {
+		psItem, err := composeFile.Ps(serviceName)
+		if err != nil {
+			return err
+		}
+		container := Container{ID: psItem.ID, Cli: composeFile.Cli}
+		return container.CpTo(src, dest, options)
+	}
+
+	cmdArgs := []string{"cp"}
 	if options.All {
 		cmdArgs = append(cmdArgs, "--all")
 	}
@@ -131,38 +299,81 @@ func (composeFile *ComposeFile) CpToService(serviceName string, src string, dest
 		cmdArgs = append(cmdArgs, "--index", fmt.Sprint(*options.Index))
 	}
 	cmdArgs = append(cmdArgs, src, fmt.Sprintf("%s:%s", serviceName, dest))
-	cmd := exec.Command("docker", cmdArgs...)
-	slog.Debug("cmdArgs", "v", cmd.Args)
-	cmd.Dir = filepath.Dir(composeFile.FilePath)
+	cmd := composeFile.command(cmdArgs...)
 	_, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			slog.Debug("cmd error", "stderr", exitErr.Stderr)
 		}
-		return fmt.Errorf("error executing docker compose: %w", err)
+		return fmt.Errorf("error executing compose: %w", err)
 	}
 	return nil
 }
 
-func LoadComposeFile(devcontainer config.Devcontainer) (ComposeFile, error) {
-	var composeFile ComposeFile
-
-	readPath := filepath.Join(
-		filepath.Dir(devcontainer.FilePath),
-		devcontainer.Spec.DockerComposeFile)
-	slog.Debug("read compose file from", "path", readPath)
+// Copies src from the service container to dest in the host.
+func (composeFile *ComposeFile) CpFromService(serviceName string, src string, dest string) error {
+	if composeFile.Cli.NoComposeCp {
+		psItem, err := composeFile.Ps(serviceName)
+		if err != nil {
+			return err
+		}
+		container := Container{ID: psItem.ID, Cli: composeFile.Cli}
+		return container.CpFrom(src, dest)
+	}
 
-	yamlFile, err := os.ReadFile(readPath)
+	cmd := composeFile.command("cp", fmt.Sprintf("%s:%s", serviceName, src), dest)
+	_, err := cmd.Output()
 	if err != nil {
-		return composeFile, err
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return fmt.Errorf("error executing compose: %w", err)
 	}
+	return nil
+}
 
-	err = yaml.Unmarshal(yamlFile, &composeFile.Spec)
-	if err != nil {
-		return composeFile, err
+// Merges the services of other into spec, like compose does with override
+// files: services are added and set fields replace existing ones.
+func (spec *ComposeFileSpec) merge(other ComposeFileSpec) {
+	if spec.Services == nil {
+		spec.Services = make(map[string]ComposeFileService, len(other.Services))
 	}
 
-	composeFile.FilePath = readPath
+	for name, service := range other.Services {
+		existing := spec.Services[name]
+		if service.User != "" {
+			existing.User = service.User
+		}
+		spec.Services[name] = existing
+	}
+}
+
+func LoadComposeFile(devcontainer config.Devcontainer, cli Cli) (ComposeFile, error) {
+	composeFile := ComposeFile{Cli: cli}
+
+	for _, fileName := range devcontainer.Spec.DockerComposeFile {
+		// compose runs from the directory of the first file, so relative
+		// paths would be resolved twice
+		readPath, err := filepath.Abs(filepath.Join(filepath.Dir(devcontainer.FilePath), fileName))
+		if err != nil {
+			return composeFile, err
+		}
+		slog.Debug("read compose file from", "path", readPath)
+
+		yamlFile, err := os.ReadFile(readPath)
+		if err != nil {
+			return composeFile, err
+		}
+
+		var spec ComposeFileSpec
+		err = yaml.Unmarshal(yamlFile, &spec)
+		if err != nil {
+			return composeFile, fmt.Errorf("error reading %s: %w", readPath, err)
+		}
+
+		composeFile.Spec.merge(spec)
+		composeFile.FilePaths = append(composeFile.FilePaths, readPath)
+	}
 
 	return composeFile, nil
 }
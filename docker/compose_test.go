@@ -0,0 +1,197 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+)
+
+func TestParsePsOutput(t *testing.T) {
+	testTable := []struct {
+		name   string
+		output string
+		want   []ComposePsItem
+	}{
+		{
+			name: "docker json lines",
+			output: `{"ID":"abc","Image":"ubuntu:22.04","Service":"ubuntu-2204","State":"running","Health":""}
+{"ID":"def","Image":"alpine:3.21","Service":"alpine-321","State":"exited","Health":""}
+`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "ubuntu:22.04", Service: "ubuntu-2204", State: "running"},
+				{ID: "def", Image: "alpine:3.21", Service: "alpine-321", State: "exited"},
+			},
+		},
+		{
+			name: "docker compose v2 with labels",
+			output: `{"Command":"\"sleep infinity\"","CreatedAt":"2025-06-01 10:00:00 +0000 UTC","ExitCode":0,"Health":"",` +
+				`"ID":"abc","Image":"ubuntu:22.04","Labels":"com.docker.compose.project=test,com.docker.compose.service=ubuntu-2204",` +
+				`"LocalVolumes":"0","Mounts":"","Name":"test-ubuntu-2204-1","Names":"test-ubuntu-2204-1","Networks":"test_default",` +
+				`"Ports":"","Project":"test","Publishers":null,"RunningFor":"2 minutes ago","Service":"ubuntu-2204","Size":"0B",` +
+				`"State":"running","Status":"Up 2 minutes"}`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "ubuntu:22.04", Service: "ubuntu-2204", State: "running"},
+			},
+		},
+		{
+			name:   "labels string only",
+			output: `{"ID":"abc","Image":"ubuntu","Labels":"com.docker.compose.service=svc,other=a=b","State":"running"}`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "ubuntu", Service: "svc", State: "running"},
+			},
+		},
+		{
+			name:   "docker json array",
+			output: `[{"ID":"abc","Image":"ubuntu:22.04","Service":"ubuntu-2204","State":"running","Health":"healthy"}]`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "ubuntu:22.04", Service: "ubuntu-2204", State: "running", Health: "healthy"},
+			},
+		},
+		{
+			name: "podman-compose",
+			output: `[{"Id":"abc","Image":"docker.io/library/ubuntu:22.04","State":"running","Status":"Up 2 minutes",
+				"Labels":{"com.docker.compose.service":"ubuntu-2204","io.podman.compose.project":"test"}}]`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "docker.io/library/ubuntu:22.04", Service: "ubuntu-2204", State: "running"},
+			},
+		},
+		{
+			name:   "old podman numeric state",
+			output: `[{"Id":"abc","Image":"ubuntu","State":2,"Status":"running","Labels":{"com.docker.compose.service":"svc"}}]`,
+			want: []ComposePsItem{
+				{ID: "abc", Image: "ubuntu", Service: "svc", State: "running"},
+			},
+		},
+		{
+			name:   "empty",
+			output: "\n",
+			want:   []ComposePsItem{},
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			got, err := ParsePsOutput([]byte(tv.output))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tv.want) {
+				t.Fatalf("expected %+v, got %+v", tv.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePsOutput_Invalid(t *testing.T) {
+	if _, err := ParsePsOutput([]byte("not json")); err == nil {
+		t.Fatal("expected error for invalid output")
+	}
+}
+
+func TestLoadComposeFile_Overrides(t *testing.T) {
+	tempDir := t.TempDir()
+	devcontainerDir := filepath.Join(tempDir, ".devcontainer")
+	if err := os.MkdirAll(devcontainerDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join(tempDir, "compose.yaml"): `
+services:
+  app:
+    image: ubuntu
+  db:
+    image: postgres
+    user: postgres
+`,
+		filepath.Join(devcontainerDir, "compose.devcontainer.yaml"): `
+services:
+  app:
+    user: vscode
+  tools:
+    image: alpine
+`,
+	}
+	for filePath, content := range files {
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	devcontainer, err := config.ParseDevcontainer(
+		[]byte(`{"dockerComposeFile": ["../compose.yaml", "compose.devcontainer.yaml"], "service": "app"}`),
+		filepath.Join(devcontainerDir, "devcontainer.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	composeFile, err := LoadComposeFile(devcontainer, DefaultCli)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	wantServices := map[string]ComposeFileService{
+		"app":   {User: "vscode"},
+		"db":    {User: "postgres"},
+		"tools": {},
+	}
+	if !reflect.DeepEqual(composeFile.Spec.Services, wantServices) {
+		t.Fatalf("expected services %+v, got %+v", wantServices, composeFile.Spec.Services)
+	}
+
+	cmd := composeFile.command("ps")
+	wantArgs := []string{
+		"docker", "compose",
+		"-f", filepath.Join(tempDir, "compose.yaml"),
+		"-f", filepath.Join(devcontainerDir, "compose.devcontainer.yaml"),
+		"ps"}
+	if !slices.Equal(cmd.Args, wantArgs) {
+		t.Fatalf("expected args %v, got %v", wantArgs, cmd.Args)
+	}
+	if cmd.Dir != tempDir {
+		t.Fatalf("expected project dir %s, got %s", tempDir, cmd.Dir)
+	}
+}
+
+func TestLoadComposeFile_RelativeDevcontainerPath(t *testing.T) {
+	tempDir := t.TempDir()
+	devcontainerDir := filepath.Join(tempDir, ".devcontainer")
+	if err := os.MkdirAll(devcontainerDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(devcontainerDir, "compose.yaml"), []byte("services:\n  app:\n    image: ubuntu\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tempDir)
+
+	devcontainer, err := config.ParseDevcontainer(
+		[]byte(`{"dockerComposeFile": "compose.yaml", "service": "app"}`),
+		filepath.Join(".devcontainer", "devcontainer.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	composeFile, err := LoadComposeFile(devcontainer, DefaultCli)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the working directory may be a symlink, compare against what Abs sees
+	wantPath, err := filepath.Abs(filepath.Join(".devcontainer", "compose.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := composeFile.command("ps")
+	wantArgs := []string{"docker", "compose", "-f", wantPath, "ps"}
+	if !slices.Equal(cmd.Args, wantArgs) {
+		t.Fatalf("expected args %v, got %v", wantArgs, cmd.Args)
+	}
+	if cmd.Dir != filepath.Dir(wantPath) {
+		t.Fatalf("expected project dir %s, got %s", filepath.Dir(wantPath), cmd.Dir)
+	}
+}
@@ -0,0 +1,155 @@
+package docker
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+)
+
+const (
+	LabelLocalFolder = "devcontainer.local_folder"
+	LabelConfigFile  = "devcontainer.config_file"
+)
+
+type Container struct {
+	ID  string
+	Cli Cli
+}
+
+func (container *Container) engine() string {
+	if container.Cli.Engine == "" {
+		return DefaultCli.Engine
+	}
+	return container.Cli.Engine
+}
+
+func (container *Container) Exec(execParams ExecParams) (string, error) {
+	cmdArgs := []string{"exec"}
+	if execParams.Dettach {
+		cmdArgs = append(cmdArgs, "--detach")
+	}
+	if len(execParams.Env) > 0 {
+		for _, val := range execParams.Env {
+			cmdArgs = append(cmdArgs, "--env", val)
+		}
+	}
+	if execParams.Interactive {
+		cmdArgs = append(cmdArgs, "--interactive")
+	}
+	if execParams.Privileged {
+		cmdArgs = append(cmdArgs, "--privileged")
+	}
+	if execParams.Tty {
+		cmdArgs = append(cmdArgs, "--tty")
+	}
+	if execParams.User != "" {
+		cmdArgs = append(cmdArgs, "--user", execParams.User)
+	}
+	if execParams.Workdir != "" {
+		cmdArgs = append(cmdArgs, "--workdir", execParams.Workdir)
+	}
+	cmdArgs = append(cmdArgs, container.ID)
+	cmdArgs = append(cmdArgs, execParams.Args...)
+	cmd := exec.Command(container.engine(), cmdArgs...)
+	slog.Debug("cmdArgs", "v", cmd.Args)
+	output, err := runExec(cmd, execParams, container.ID[:min(len(container.ID), 12)])
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return "", fmt.Errorf("error executing %s: %w", container.engine(), err)
+	}
+	return string(output[:]), nil
+}
+
+func (container *Container) CpTo(src string, dest string, options CpToServiceOptions) error {
+	cmdArgs := []string{"cp"}
+	if options.Archive {
+		cmdArgs = append(cmdArgs, "--archive")
+	}
+	if options.FollowLink {
+		cmdArgs = append(cmdArgs, "--follow-link")
+	}
+	cmdArgs = append(cmdArgs, src, fmt.Sprintf("%s:%s", container.ID, dest))
+	cmd := exec.Command(container.engine(), cmdArgs...)
+	slog.Debug("cmdArgs", "v", cmd.Args)
+	_, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return fmt.Errorf("error executing %s: %w", container.engine(), err)
+	}
+	return nil
+}
+
+func (container *Container) CpFrom(src string, dest string) error {
+	cmd := exec.Command(container.engine(), "cp", fmt.Sprintf("%s:%s", container.ID, src), dest)
+	slog.Debug("cmdArgs", "v", cmd.Args)
+	_, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return fmt.Errorf("error executing %s: %w", container.engine(), err)
+	}
+	return nil
+}
+
+func findContainerByLabels(cli Cli, labels ...string) ([]string, error) {
+	cmdArgs := []string{"ps", "-q"}
+	for _, label := range labels {
+		cmdArgs = append(cmdArgs, "--filter", "label="+label)
+	}
+	cmd := exec.Command(cli.Engine, cmdArgs...)
+	slog.Debug("cmdArgs", "v", cmd.Args)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			slog.Debug("cmd error", "stderr", exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("error executing %s: %w", cli.Engine, err)
+	}
+
+	return strings.Fields(string(output)), nil
+}
+
+// Locates the running container for a devcontainer using the labels the
+// devcontainer CLI applies when creating it. Falls back to matching only the
+// local folder, since older CLI versions don't set the config file label.
+func FindContainer(devcontainer config.Devcontainer, cli Cli) (Container, error) {
+	localFolder, err := devcontainer.LocalWorkspaceFolder()
+	if err != nil {
+		return Container{}, err
+	}
+	configFile, err := devcontainer.AbsFilePath()
+	if err != nil {
+		return Container{}, err
+	}
+
+	ids, err := findContainerByLabels(cli,
+		fmt.Sprintf("%s=%s", LabelLocalFolder, localFolder),
+		fmt.Sprintf("%s=%s", LabelConfigFile, configFile))
+	if err != nil {
+		return Container{}, err
+	}
+
+	if len(ids) == 0 {
+		ids, err = findContainerByLabels(cli, fmt.Sprintf("%s=%s", LabelLocalFolder, localFolder))
+		if err != nil {
+			return Container{}, err
+		}
+	}
+
+	if len(ids) == 0 {
+		return Container{}, fmt.Errorf("no running container found for '%s'. try starting the devcontainer first", localFolder)
+	}
+	if len(ids) > 1 {
+		slog.Warn("found more than one container for devcontainer, using the first", "ids", ids)
+	}
+
+	return Container{ID: ids[0], Cli: cli}, nil
+}
@@ -1,12 +1,86 @@
 package docker
 
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
 type ExecParams struct {
 	Args        []string
 	Dettach     bool
 	Env         []string
 	Interactive bool
 	Privileged  bool
+	Stream      bool
 	Tty         bool
 	User        string
 	Workdir     string
 }
+
+func prefixLines(r io.Reader, w io.Writer, prefix string, collect io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fmt.Fprintf(w, "%s%s\n", prefix, scanner.Bytes())
+		if collect != nil {
+			collect.Write(scanner.Bytes())
+			collect.Write([]byte("\n"))
+		}
+	}
+	return scanner.Err()
+}
+
+// Runs a command forwarding its stdout and stderr to the terminal with
+// prefix, and returns the stdout.
+func streamCmd(cmd *exec.Cmd, prefix string) ([]byte, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = prefixLines(stdout, os.Stdout, fmt.Sprintf("[%s] ", prefix), &output)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = prefixLines(stderr, os.Stderr, fmt.Sprintf("[%s:err] ", prefix), nil)
+	}()
+	wg.Wait()
+
+	return output.Bytes(), cmd.Wait()
+}
+
+// Runs an exec command. Interactive commands are connected to the terminal
+// and return no output. Streamed ones forward their output to the terminal
+// line by line while they run, prefixed with prefix.
+func runExec(cmd *exec.Cmd, execParams ExecParams, prefix string) ([]byte, error) {
+	if execParams.Interactive {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return nil, cmd.Run()
+	}
+
+	if execParams.Stream {
+		return streamCmd(cmd, prefix)
+	}
+
+	return cmd.Output()
+}
@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrefixLines(t *testing.T) {
+	var out, collected bytes.Buffer
+	err := prefixLines(strings.NewReader("one\ntwo\nthree"), &out, "[svc] ", &collected)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out.String() != "[svc] one\n[svc] two\n[svc] three\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if collected.String() != "one\ntwo\nthree\n" {
+		t.Fatalf("unexpected collected output %q", collected.String())
+	}
+}
+
+func TestStreamCmd(t *testing.T) {
+	output, err := streamCmd(exec.Command("sh", "-c", "echo out; echo err >&2"), "svc")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(output) != "out\n" {
+		t.Fatalf("expected only stdout to be returned, got %q", output)
+	}
+
+	_, err = streamCmd(exec.Command("sh", "-c", "exit 3"), "svc")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit error, got %v", err)
+	}
+}
+
+func TestGetCli_Auto(t *testing.T) {
+	// a docker without the compose plugin
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ntest \"$1\" = compose && exit 1\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(binDir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	cli, err := GetCli(CliAuto, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cli.Name != "docker" {
+		t.Fatalf("expected docker, got %s", cli.Name)
+	}
+
+	if _, err := GetCli(CliAuto, true); err == nil {
+		t.Fatal("expected error without a compose cli")
+	}
+}
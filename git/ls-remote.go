@@ -0,0 +1,30 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Lists the references of a remote repository, without cloning it. Annotated
+// tags are also listed peeled, as `refs/tags/<tag>^{}`.
+func LsRemote(url string) (map[string]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+
+	refs, err := remote.List(&git.ListOptions{PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return nil, fmt.Errorf("error listing remote %s: %w", url, err)
+	}
+
+	result := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		result[ref.Name().String()] = ref.Hash().String()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,27 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// The first url of a remote of a local repository.
+func RemoteUrl(repoDir string, name string) (string, error) {
+	r, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	remote, err := r.Remote(name)
+	if err != nil {
+		return "", err
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", fmt.Errorf("remote %s has no url", name)
+	}
+
+	return urls[0], nil
+}
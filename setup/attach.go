@@ -0,0 +1,110 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+// Starts the login shell of the user
+const LoginShellScript = `shell=$(getent passwd "$(id -u)" | cut -d: -f7); exec "${shell:-/bin/sh}" -l`
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Checks what's needed to open a session, before anything runs in the
+// target.
+func validateAttach(devcontainer config.Devcontainer, args []string) error {
+	if devcontainer.Spec.RemoteUser == "" {
+		return fmt.Errorf("remoteUser property from devcontainer file must not be empty")
+	}
+	if len(args) == 0 || args[0] == "" {
+		return fmt.Errorf("nothing to run, neovim.runscript must not be empty")
+	}
+	if _, err := devcontainer.ContainerWorkspaceFolder(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// The parameters for an interactive session as the remote user, in the
+// workspace folder and with remoteEnv and the nvim-mindevc tools in PATH.
+func AttachExecParams(
+	myConfig config.Config,
+	devcontainer config.Devcontainer,
+	remote target.Target,
+	args []string,
+) (docker.ExecParams, error) {
+	if err := validateAttach(devcontainer, args); err != nil {
+		return docker.ExecParams{}, err
+	}
+
+	workdir, err := devcontainer.ContainerWorkspaceFolder()
+	if err != nil {
+		return docker.ExecParams{}, err
+	}
+
+	containerEnv, err := remoteContainerEnv(remote)
+	if err != nil {
+		return docker.ExecParams{}, err
+	}
+
+	env := devcontainer.RemoteEnvList(containerEnv)
+	if _, ok := devcontainer.Spec.RemoteEnv["PATH"]; !ok {
+		binDir := filepath.Join(myConfig.Remote.Workdir, "bin")
+		env = append(env, "PATH="+strings.Join([]string{containerEnv["PATH"], binDir}, ":"))
+	}
+
+	return docker.ExecParams{
+		Args:        args,
+		Env:         env,
+		Interactive: true,
+		Tty:         stdinIsTerminal(),
+		User:        devcontainer.Spec.RemoteUser,
+		Workdir:     workdir,
+	}, nil
+}
+
+// Opens an interactive session in the target running args, starting it and
+// running the lifecycle commands first like an editor attaching would.
+func Attach(
+	myConfig config.Config,
+	devcontainer config.Devcontainer,
+	remote target.Target,
+	args []string,
+) error {
+	if err := validateAttach(devcontainer, args); err != nil {
+		return err
+	}
+
+	stop, err := StartTarget(myConfig, devcontainer, remote)
+	defer stop()
+	if err != nil {
+		return err
+	}
+
+	execParams, err := AttachExecParams(myConfig, devcontainer, remote, args)
+	if err != nil {
+		return err
+	}
+
+	if !myConfig.Container.SkipLifecycle {
+		err := RunLifecycleHooks(myConfig, devcontainer, remote, AttachLifecycleHooks(devcontainer))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = remote.Exec(execParams)
+	return err
+}
@@ -0,0 +1,126 @@
+package setup
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestAttach(t *testing.T) {
+	devcontainer, err := config.ParseDevcontainer([]byte(`{
+		"remoteUser": "1000",
+		"workspaceFolder": "/code",
+		"remoteEnv": {"EDITOR": "nvim"},
+		"postAttachCommand": "echo attached",
+	}`), "/src/project/.devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var myConfig config.Config
+	myConfig.Remote.Workdir = "/opt/nvim-mindevc"
+	myConfig.Neovim.Runscript = "/opt/nvim-mindevc/bin/nvim"
+
+	remote := &target.LocalDir{
+		Root: t.TempDir(),
+		ExecFunc: func(execParams docker.ExecParams) (string, error) {
+			if slices.Equal(execParams.Args, []string{"env"}) {
+				return "PATH=/usr/bin\n", nil
+			}
+			return "", nil
+		},
+	}
+
+	err = Attach(myConfig, devcontainer, remote, []string{myConfig.Neovim.Runscript, "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	session := remote.Executed[len(remote.Executed)-1]
+	if !slices.Equal(session.Args, []string{"/opt/nvim-mindevc/bin/nvim", "file.txt"}) {
+		t.Fatalf("unexpected args %v", session.Args)
+	}
+	if !session.Interactive || session.User != "1000" || session.Workdir != "/code" {
+		t.Fatalf("unexpected exec params %+v", session)
+	}
+	slices.Sort(session.Env)
+	wantEnv := []string{"EDITOR=nvim", "PATH=/usr/bin:/opt/nvim-mindevc/bin"}
+	if !slices.Equal(session.Env, wantEnv) {
+		t.Fatalf("expected env %v, got %v", wantEnv, session.Env)
+	}
+
+	postAttach := remote.Executed[len(remote.Executed)-2]
+	if !slices.Equal(postAttach.Args, []string{"/bin/sh", "-c", "echo attached"}) {
+		t.Fatalf("expected postAttachCommand before the session, got %v", postAttach.Args)
+	}
+}
+
+func TestAttach_StopCompose(t *testing.T) {
+	testTable := []struct {
+		name           string
+		shutdownAction string
+		wantStopped    bool
+	}{
+		{name: "default", wantStopped: true},
+		{name: "stop compose", shutdownAction: config.ShutdownActionStopCompose, wantStopped: true},
+		{name: "none", shutdownAction: config.ShutdownActionNone},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var devcontainer config.Devcontainer
+			devcontainer.Spec.DockerComposeFile = config.StringList{"compose.yaml"}
+			devcontainer.Spec.RemoteUser = "user"
+			devcontainer.Spec.ShutdownAction = tv.shutdownAction
+
+			var myConfig config.Config
+			myConfig.Container.Up = true
+			myConfig.Container.SkipLifecycle = true
+
+			remote := &startableLocalDir{LocalDir: &target.LocalDir{Root: t.TempDir()}}
+
+			if err := Attach(myConfig, devcontainer, remote, []string{"true"}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !remote.started {
+				t.Fatal("expected the session to start the target")
+			}
+			if remote.stopped != tv.wantStopped {
+				t.Fatalf("expected stopped to be %v", tv.wantStopped)
+			}
+		})
+	}
+}
+
+func TestAttach_Validation(t *testing.T) {
+	testTable := []struct {
+		name       string
+		remoteUser string
+		args       []string
+	}{
+		{name: "no remote user", args: []string{"/opt/nvim-mindevc/bin/nvim"}},
+		{name: "no runscript", remoteUser: "user", args: []string{""}},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var devcontainer config.Devcontainer
+			devcontainer.Spec.RemoteUser = tv.remoteUser
+			devcontainer.Spec.PostStartCommand = config.LifecycleCommand{"": {"/bin/sh", "-c", "echo started"}}
+
+			var myConfig config.Config
+			myConfig.Container.Up = true
+
+			remote := &startableLocalDir{LocalDir: &target.LocalDir{Root: t.TempDir()}}
+			if err := Attach(myConfig, devcontainer, remote, tv.args); err == nil {
+				t.Fatal("expected error")
+			}
+			if remote.started || len(remote.Executed) > 0 {
+				t.Fatalf("expected nothing to start or run, got %v", remote.Executed)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package setup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/git"
+)
+
+const NeovimRepoUrl = "https://github.com/neovim/neovim"
+
+// Records the upstream commit of a neovim source folder or build artifact.
+const neovimCommitFile = ".nvim-mindevc-commit"
+
+// Where Setup copies the prebuilt neovim from the host cache.
+const neovimShippedDir = "_shipped"
+
+// How an existing neovim build is handled.
+type BuildMode struct {
+	// Rebuilds if the tag points to another commit upstream
+	Update bool
+	// Downloads the sources again and rebuilds
+	Rebuild bool
+	// Restores the build replaced by the last update or rebuild
+	Rollback bool
+	// Installs the build shipped by the setup if it's a different one,
+	// compiling only if it doesn't run
+	Prebuilt bool
+}
+
+func (mode BuildMode) Args() []string {
+	var args []string
+	if mode.Update {
+		args = append(args, "--update")
+	}
+	if mode.Rebuild {
+		args = append(args, "--rebuild")
+	}
+	if mode.Rollback {
+		args = append(args, "--rollback")
+	}
+	if mode.Prebuilt {
+		args = append(args, "--prebuilt")
+	}
+	return args
+}
+
+// The commit a neovim tag currently points to upstream.
+func ResolveNeovimCommit(tag string) (string, error) {
+	if neovimCommitRe.MatchString(tag) {
+		return tag, nil
+	}
+
+	refs, err := git.LsRemote(NeovimRepoUrl)
+	if err != nil {
+		return "", err
+	}
+
+	if hash, ok := refs["refs/tags/"+tag+"^{}"]; ok {
+		return hash, nil
+	}
+	if hash, ok := refs["refs/tags/"+tag]; ok {
+		return hash, nil
+	}
+
+	return "", fmt.Errorf("neovim tag '%s' not found upstream", tag)
+}
+
+// Whether two commits are the same, either may be abbreviated.
+func commitsMatch(a string, b string) bool {
+	return a != "" && b != "" && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a))
+}
+
+func readCommit(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func writeCommit(file string, commit string) error {
+	if commit == "" {
+		err := os.Remove(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(file, []byte(commit+"\n"), 0o644)
+}
+
+// The commit of a github source archive, which is stored in the comment of
+// its global header.
+func archiveCommit(archive string) string {
+	fp, err := os.Open(archive)
+	if err != nil {
+		return ""
+	}
+	defer fp.Close()
+
+	gzReader, err := gzip.NewReader(fp)
+	if err != nil {
+		return ""
+	}
+
+	header, err := tar.NewReader(gzReader).Next()
+	if err != nil || header.Typeflag != tar.TypeXGlobalHeader {
+		return ""
+	}
+
+	return header.PAXRecords["comment"]
+}
+
+// Moves newFile to artifact, keeping the current artifact as `.prev`.
+func replaceArtifact(artifact string, newFile string) error {
+	if _, err := os.Stat(artifact); err == nil {
+		if err := os.Rename(artifact, artifact+".prev"); err != nil {
+			return err
+		}
+		if err := writeCommit(artifact+".prev.commit", readCommit(artifact+".commit")); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(newFile, artifact); err != nil {
+		return err
+	}
+	if err := writeCommit(artifact+".commit", readCommit(newFile+".commit")); err != nil {
+		return err
+	}
+	os.Remove(newFile + ".commit")
+
+	return nil
+}
+
+// Swaps the artifact with the previous one.
+func rollbackArtifact(artifact string) error {
+	prev := artifact + ".prev"
+	if _, err := os.Stat(prev); err != nil {
+		return fmt.Errorf("no previous neovim build to roll back to")
+	}
+
+	tmpFile := artifact + ".rollback"
+	if err := os.Rename(prev, tmpFile); err != nil {
+		return err
+	}
+	if err := writeCommit(tmpFile+".commit", readCommit(prev+".commit")); err != nil {
+		return err
+	}
+	os.Remove(prev + ".commit")
+
+	return replaceArtifact(artifact, tmpFile)
+}
+
+// The configured hash is for the source of the main tag.
+func neovimHash(myConfig config.Config, tag string) string {
+	if tag == myConfig.Neovim.Tag {
+		return myConfig.Neovim.Hash
+	}
+	return ""
+}
+
+// The folder where a neovim tag is installed, inside the remote workdir.
+func NeovimDir(workdir string, tag string) string {
+	return filepath.Join(workdir, "neovim", tag)
+}
+
+// Installs the neovim of tag in the remote workdir, from a prebuilt artifact
+// if there's a suitable one, otherwise compiling it. Returns the neovim
+// folder.
+func InstallNeovim(
+	myConfig config.Config,
+	tag string,
+	arch config.ConfigToolArch,
+	zigBin string,
+	mode BuildMode,
+) (string, error) {
+	if _, err := NeovimSourceUrl(tag); err != nil {
+		return "", err
+	}
+
+	neovimDir := NeovimDir(myConfig.Remote.Workdir, tag)
+	if err := os.MkdirAll(neovimDir, 0o755); err != nil {
+		return "", err
+	}
+
+	buildArgs, err := BuildArgs(myConfig.Neovim.Build)
+	if err != nil {
+		return "", err
+	}
+
+	neovimSrc := filepath.Join(neovimDir, "neovim-"+tag)
+	artifact := filepath.Join(neovimDir, NeovimArtifactName(tag, arch, Libc(arch), buildFlavor(buildArgs)))
+	shipped := filepath.Join(myConfig.Remote.Workdir, "neovim", neovimShippedDir, filepath.Base(artifact))
+	defer os.Remove(shipped)
+	defer os.Remove(shipped + ".commit")
+
+	if mode.Rollback {
+		if err := rollbackArtifact(artifact); err != nil {
+			slog.Warn("not rolling back neovim", "tag", tag, "error", err)
+			mode = BuildMode{}
+		} else {
+			slog.Info("restoring previous neovim build", "tag", tag, "commit", readCommit(artifact+".commit"))
+			if err := ExtractNeovimArtifact(artifact, neovimSrc); err != nil {
+				return "", err
+			}
+			return neovimSrc, writeBuildArgs(neovimSrc, buildArgs)
+		}
+	}
+
+	// a build with other options must be replaced
+	sameBuild := slices.Equal(readBuildArgs(neovimSrc), buildArgs)
+	if !sameBuild {
+		slog.Info("neovim build options changed", "tag", tag)
+	}
+
+	var upstream string
+	var installed bool
+	switch {
+	case mode.Rebuild:
+	case mode.Update:
+		upstream, err = ResolveNeovimCommit(tag)
+		if err != nil {
+			return "", err
+		}
+
+		current := readCommit(filepath.Join(neovimSrc, neovimCommitFile))
+		installed = commitsMatch(current, upstream) && sameBuild && NeovimWorks(neovimSrc)
+		if installed {
+			slog.Info("neovim is up to date", "tag", tag, "commit", current)
+		} else {
+			slog.Info("neovim changed upstream", "tag", tag, "from", current, "to", upstream)
+		}
+	case mode.Prebuilt:
+		current := readCommit(filepath.Join(neovimSrc, neovimCommitFile))
+		installed = commitsMatch(current, readCommit(shipped+".commit")) && sameBuild && NeovimWorks(neovimSrc)
+	default:
+		installed = sameBuild && NeovimWorks(neovimSrc)
+	}
+
+	if _, err := os.Stat(shipped); err == nil && !installed && !mode.Rebuild {
+		if upstream == "" || commitsMatch(readCommit(shipped+".commit"), upstream) {
+			slog.Info("extracting prebuilt neovim")
+			if err := replaceArtifact(artifact, shipped); err != nil {
+				return "", err
+			}
+			if err := ExtractNeovimArtifact(artifact, neovimSrc); err != nil {
+				return "", err
+			}
+			if err := writeBuildArgs(neovimSrc, buildArgs); err != nil {
+				return "", err
+			}
+			installed = NeovimWorks(neovimSrc)
+		}
+	}
+
+	if !installed {
+		neovimSrc, err = DownloadAndExtractNeovim(neovimDir, tag, neovimHash(myConfig, tag), mode.Update || mode.Rebuild)
+		if err != nil {
+			return "", err
+		}
+
+		if err := BuildNeovim(zigBin, neovimSrc, myConfig.Neovim.Build); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := os.Stat(artifact); err != nil || !installed {
+		slog.Info("packaging neovim build")
+		newArtifact := artifact + ".new"
+		if err := TarNeovim(neovimSrc, newArtifact); err != nil {
+			return "", err
+		}
+		if err := replaceArtifact(artifact, newArtifact); err != nil {
+			return "", err
+		}
+	}
+
+	return neovimSrc, nil
+}
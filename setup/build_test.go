@@ -0,0 +1,98 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCommitsMatch(t *testing.T) {
+	testTable := []struct {
+		name string
+		a    string
+		b    string
+		want bool
+	}{
+		{name: "equal", a: "a1b2c3d4", b: "a1b2c3d4", want: true},
+		{name: "abbreviated", a: "a1b2c3d", b: "a1b2c3d4e5f6", want: true},
+		{name: "different", a: "a1b2c3d", b: "b1b2c3d", want: false},
+		{name: "empty", a: "", b: "a1b2c3d", want: false},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			if got := commitsMatch(tv.a, tv.b); got != tv.want {
+				t.Fatalf("expected %v, got %v", tv.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildMode_Args(t *testing.T) {
+	if args := (BuildMode{}).Args(); len(args) != 0 {
+		t.Fatalf("expected no args, got %v", args)
+	}
+	if args := (BuildMode{Update: true}).Args(); !slices.Equal(args, []string{"--update"}) {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestArchiveCommit(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "neovim.tar.gz")
+	if err := os.WriteFile(archive, neovimSourceArchive(t, "neovim-nightly"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := archiveCommit(archive); got != "abc" {
+		t.Fatalf("expected commit abc, got %q", got)
+	}
+}
+
+func TestReplaceAndRollbackArtifact(t *testing.T) {
+	tempDir := t.TempDir()
+	artifact := filepath.Join(tempDir, "nvim.tar")
+
+	for _, build := range []string{"one", "two"} {
+		newFile := artifact + ".new"
+		if err := os.WriteFile(newFile, []byte(build), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeCommit(newFile+".commit", build); err != nil {
+			t.Fatal(err)
+		}
+		if err := replaceArtifact(artifact, newFile); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	check := func(file string, want string) {
+		t.Helper()
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(content) != want {
+			t.Fatalf("expected %s to be %q, got %q", file, want, content)
+		}
+		if got := readCommit(file + ".commit"); got != want {
+			t.Fatalf("expected %s commit to be %q, got %q", file, want, got)
+		}
+	}
+
+	check(artifact, "two")
+	check(artifact+".prev", "one")
+
+	if err := rollbackArtifact(artifact); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	check(artifact, "one")
+	check(artifact+".prev", "two")
+
+	if _, err := os.Stat(artifact + ".new.commit"); err == nil {
+		t.Fatal("expected temporary commit file to be removed")
+	}
+
+	if err := rollbackArtifact(filepath.Join(tempDir, "missing.tar")); err == nil {
+		t.Fatal("expected error without previous build")
+	}
+}
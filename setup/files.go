@@ -0,0 +1,143 @@
+package setup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+	"github.com/davidrios/nvim-mindevc/utils"
+)
+
+// The path of a file in the target, with `~` expanded to remoteHome.
+func remoteFilePath(path string, remoteHome string) (string, error) {
+	if path == "~" {
+		return remoteHome, nil
+	}
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(remoteHome, path[2:]), nil
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("target path must be absolute or start with ~/: %s", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// A local path with the source of a file, downloading https sources to
+// downloadDir. Relative paths are relative to the config file.
+func fileSource(myConfig config.Config, file config.ConfigFile, downloadDir string) (string, error) {
+	switch {
+	case strings.HasPrefix(file.Source, "https://"):
+		parsedUrl, err := url.Parse(file.Source)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(downloadDir, 0o755); err != nil {
+			return "", err
+		}
+		if file.Hash != "" {
+			return DownloadToolHttp(downloadDir, file.Source, parsedUrl, file.Hash)
+		}
+
+		// no hash to cache it by, always downloaded
+		downloaded := filepath.Join(downloadDir, filepath.Base(parsedUrl.Path))
+		if err := utils.DownloadFileHttp(file.Source, downloaded+".tmp"); err != nil {
+			return "", err
+		}
+		return downloaded, os.Rename(downloaded+".tmp", downloaded)
+	case strings.HasPrefix(file.Source, "file://"):
+		if file.Source == "file://" {
+			return "", fmt.Errorf("empty file source %s", file.Source)
+		}
+		return myConfig.ResolvePath(file.Source[len("file://"):])
+	case strings.Contains(file.Source, "://"):
+		return "", fmt.Errorf("unsupported file source %s", file.Source)
+	}
+	return myConfig.ResolvePath(file.Source)
+}
+
+// Copies the configured files to the target, owned by the remote user unless
+// set otherwise. Files are replaced on every setup, folders are merged like
+// the neovim config.
+func CopyFiles(myConfig config.Config, remote target.Target, remoteHome string, user string, cacheDir string) error {
+	for _, file := range myConfig.Files {
+		if file.Source == "" || file.Target == "" {
+			return fmt.Errorf("files entries need a source and a target")
+		}
+
+		if file.Mode != "" {
+			if _, err := strconv.ParseUint(file.Mode, 8, 32); err != nil {
+				return fmt.Errorf("invalid mode %s for %s", file.Mode, file.Target)
+			}
+		}
+
+		dest, err := remoteFilePath(file.Target, remoteHome)
+		if err != nil {
+			return err
+		}
+
+		owner := file.Owner
+		if owner == "" {
+			owner = user
+		}
+
+		// downloads without hash use a temporary folder
+		downloadDir := filepath.Join(cacheDir, "files")
+		if strings.HasPrefix(file.Source, "https://") && file.Hash == "" {
+			downloadDir, err = os.MkdirTemp("", "nvim-mindevc-file-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(downloadDir)
+		}
+
+		src, err := fileSource(myConfig, file, downloadDir)
+		if err != nil {
+			return fmt.Errorf("error getting %s: %w", file.Source, err)
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+
+		// missing parents in the home belong to the user even if the file
+		// doesn't
+		if err := mkdirRemote(remote, filepath.Dir(dest), remoteHome, user); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			_, err := syncFolder(remote, src, dest, remoteHome, owner, ConfigSyncOptions{Strategy: ConfigSyncMerge})
+			if err != nil {
+				return fmt.Errorf("error copying %s: %w", file.Source, err)
+			}
+		} else {
+			if err := remote.CopyTo(src, dest, target.CopyOptions{FollowLink: true}); err != nil {
+				return fmt.Errorf("error copying %s: %w", file.Source, err)
+			}
+			if err := chownRemote(remote, owner, dest, false); err != nil {
+				return err
+			}
+		}
+
+		if file.Mode != "" {
+			_, err := remote.Exec(docker.ExecParams{
+				Args: []string{"chmod", file.Mode, dest},
+				User: "root",
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		slog.Debug("copied file to remote", "source", file.Source, "target", dest)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestRemoteFilePath(t *testing.T) {
+	testTable := []struct {
+		path     string
+		expected string
+		wantErr  bool
+	}{
+		{path: "~", expected: "/home/user"},
+		{path: "~/.gitconfig", expected: "/home/user/.gitconfig"},
+		{path: "/etc/inputrc", expected: "/etc/inputrc"},
+		{path: ".gitconfig", wantErr: true},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.path, func(t *testing.T) {
+			got, err := remoteFilePath(tv.path, "/home/user")
+			if tv.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tv.expected {
+				t.Fatalf("expected %s, got %s", tv.expected, got)
+			}
+		})
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "gitconfig"), []byte("[user]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "starship"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "starship", "starship.toml"), []byte("format = ''\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	inputrc := []byte("set editing-mode vi\n")
+	useFakeTransport(t, fakeTransport{"https://example.com/inputrc": inputrc})
+
+	testTable := []struct {
+		name      string
+		file      config.ConfigFile
+		remote    string
+		wantOwner string
+		wantErr   bool
+	}{
+		{
+			name:      "file",
+			file:      config.ConfigFile{Source: filepath.Join(dir, "gitconfig"), Target: "~/.gitconfig", Mode: "0600"},
+			remote:    "/home/user/.gitconfig",
+			wantOwner: "user",
+		},
+		{
+			name:      "file uri to folder",
+			file:      config.ConfigFile{Source: "file://" + filepath.Join(dir, "starship"), Target: "~/.config/starship", Owner: "root"},
+			remote:    "/home/user/.config/starship/starship.toml",
+			wantOwner: "root",
+		},
+		{
+			name:      "https with hash",
+			file:      config.ConfigFile{Source: "https://example.com/inputrc", Hash: fmt.Sprintf("%x", sha256.Sum256(inputrc)), Target: "/etc/inputrc"},
+			remote:    "/etc/inputrc",
+			wantOwner: "user",
+		},
+		{
+			name:   "https without hash",
+			file:   config.ConfigFile{Source: "https://example.com/inputrc", Target: "~/.inputrc"},
+			remote: "/home/user/.inputrc",
+		},
+		{
+			name:    "wrong hash",
+			file:    config.ConfigFile{Source: "https://example.com/inputrc", Hash: strings.Repeat("0", 64), Target: "/etc/inputrc"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode",
+			file:    config.ConfigFile{Source: filepath.Join(dir, "gitconfig"), Target: "~/.gitconfig", Mode: "rw"},
+			wantErr: true,
+		},
+		{
+			name:      "relative source",
+			file:      config.ConfigFile{Source: "gitconfig", Target: "~/.gitconfig"},
+			remote:    "/home/user/.gitconfig",
+			wantOwner: "user",
+		},
+		{
+			name:    "short missing source",
+			file:    config.ConfigFile{Source: "x", Target: "~/.x"},
+			wantErr: true,
+		},
+		{
+			name:    "short file uri",
+			file:    config.ConfigFile{Source: "file://x", Target: "~/.x"},
+			wantErr: true,
+		},
+		{
+			name:    "empty file uri",
+			file:    config.ConfigFile{Source: "file://", Target: "~/.x"},
+			wantErr: true,
+		},
+		{
+			name:    "relative target",
+			file:    config.ConfigFile{Source: filepath.Join(dir, "gitconfig"), Target: ".gitconfig"},
+			wantErr: true,
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			remote := &target.LocalDir{
+				Root: t.TempDir(),
+				ExecFunc: func(execParams docker.ExecParams) (string, error) {
+					if execParams.Args[0] == "sh" {
+						return "nvim_not_found", nil
+					}
+					return "", nil
+				},
+			}
+
+			var myConfig config.Config
+			myConfig.FilePath = filepath.Join(dir, ".nvim-mindevc.yaml")
+			myConfig.Files = []config.ConfigFile{tv.file}
+
+			err := CopyFiles(myConfig, remote, "/home/user", "user", filepath.Join(dir, "cache"))
+			if tv.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if _, err := os.Stat(remote.Path(tv.remote)); err != nil {
+				t.Fatalf("expected remote file: %s", err)
+			}
+
+			if tv.wantOwner != "" && !slices.ContainsFunc(remote.Executed, func(execParams docker.ExecParams) bool {
+				return execParams.Args[0] == "chown" && slices.Contains(execParams.Args, tv.wantOwner)
+			}) {
+				t.Fatalf("expected chown to %s, got %v", tv.wantOwner, remote.Executed)
+			}
+
+			chmod := slices.ContainsFunc(remote.Executed, func(execParams docker.ExecParams) bool {
+				return execParams.Args[0] == "chmod"
+			})
+			if chmod != (tv.file.Mode != "") {
+				t.Fatalf("unexpected chmod: %v", remote.Executed)
+			}
+		})
+	}
+}
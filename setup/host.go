@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/davidrios/nvim-mindevc/config"
+)
+
+// The zig target to cross-compile for a target system. glibc builds link
+// against an old version so they run in most distro images. musl builds are
+// static and can't load parsers, so they must be asked for explicitly.
+func hostBuildTarget(build config.ConfigNeovimBuild, arch config.ConfigToolArch, libc string) (string, error) {
+	if build.Target != "" {
+		return build.Target, nil
+	}
+	if libc == LibcMusl {
+		return "", fmt.Errorf("building neovim on the host for musl needs neovim.build.target set to %s-linux-musl, "+
+			"for a static build that can't load treesitter parser libraries, or build it in the devcontainer "+
+			"with neovim.build.allow_system_packages instead of neovim.build.on_host", arch)
+	}
+	return fmt.Sprintf("%s-linux-gnu.2.28", arch), nil
+}
+
+// Cross-compiles the neovim of tag on the host for a target with arch and
+// libc, with the zig from DownloadAndExtractLocalTools, and stores the
+// result in the cache like a build fetched from a target. Does nothing if
+// there's a cached build already, unless updating or rebuilding.
+func BuildNeovimOnHost(
+	myConfig config.Config,
+	cacheDir string,
+	tag string,
+	arch config.ConfigToolArch,
+	libc string,
+	mode BuildMode,
+) error {
+	buildArgs, err := BuildArgs(myConfig.Neovim.Build)
+	if err != nil {
+		return err
+	}
+
+	artifact := filepath.Join(cacheDir, "neovim", NeovimArtifactName(tag, arch, libc, buildFlavor(buildArgs)))
+	if _, err := os.Stat(artifact); err == nil && !mode.Update && !mode.Rebuild {
+		return nil
+	}
+
+	hostTarget, err := hostBuildTarget(myConfig.Neovim.Build, arch, libc)
+	if err != nil {
+		return err
+	}
+
+	if err := DownloadAndExtractLocalTools(cacheDir); err != nil {
+		return err
+	}
+	zigBin := filepath.Join(cacheDir, "bin", "zig")
+
+	srcDir := filepath.Join(cacheDir, "neovim", "src")
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		return err
+	}
+
+	neovimSrc, err := DownloadAndExtractNeovim(srcDir, tag, neovimHash(myConfig, tag), mode.Update || mode.Rebuild)
+	if err != nil {
+		return err
+	}
+
+	commit := readCommit(filepath.Join(neovimSrc, neovimCommitFile))
+	if mode.Update && commitsMatch(commit, readCommit(artifact+".commit")) {
+		slog.Info("neovim is up to date", "tag", tag, "commit", commit)
+		return nil
+	}
+
+	// the build options are the configured ones plus the target, builds are
+	// identified by the configured ones, the same as in the target
+	build := myConfig.Neovim.Build
+	build.Target = hostTarget
+	hostArgs, err := BuildArgs(build)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("compiling neovim on host, this may take a while...", "tag", tag, "target", build.Target)
+	if err := zigBuild(zigBin, neovimSrc, hostArgs); err != nil {
+		return err
+	}
+
+	newArtifact := artifact + ".new"
+	if err := TarNeovim(neovimSrc, newArtifact); err != nil {
+		return err
+	}
+	if err := replaceArtifact(artifact, newArtifact); err != nil {
+		return err
+	}
+	slog.Info("cached neovim build", "file", artifact, "commit", commit)
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestHostBuildTarget(t *testing.T) {
+	testTable := []struct {
+		name    string
+		build   config.ConfigNeovimBuild
+		arch    config.ConfigToolArch
+		libc    string
+		want    string
+		wantErr bool
+	}{
+		{name: "glibc", arch: config.ToolArch_x86_64, libc: LibcGlibc, want: "x86_64-linux-gnu.2.28"},
+		{name: "musl", arch: config.ToolArch_aarch64, libc: LibcMusl, wantErr: true},
+		{
+			name:  "configured musl",
+			build: config.ConfigNeovimBuild{Target: "aarch64-linux-musl"},
+			arch:  config.ToolArch_aarch64,
+			libc:  LibcMusl,
+			want:  "aarch64-linux-musl",
+		},
+		{
+			name:  "configured",
+			build: config.ConfigNeovimBuild{Target: "x86_64-linux-musl"},
+			arch:  config.ToolArch_x86_64,
+			libc:  LibcGlibc,
+			want:  "x86_64-linux-musl",
+		},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			got, err := hostBuildTarget(tv.build, tv.arch, tv.libc)
+			if tv.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tv.want {
+				t.Fatalf("expected %s, got %s", tv.want, got)
+			}
+		})
+	}
+}
+
+func TestSetup_BuildOnHostCached(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	myConfig := writeTestConfig(t, tempDir, fmt.Sprintf(`
+cache_dir: %s
+install_tools: []
+neovim:
+  config_uri: file://%s
+  build:
+    on_host: true
+`, cacheDir, tempDir))
+	useFakeTransport(t, fakeSelfBinary(t, myConfig.Config, config.ToolArch_aarch64))
+
+	artifactName := NeovimArtifactName("nightly", config.ToolArch_aarch64, LibcGlibc, "")
+	cachedArtifact := filepath.Join(cacheDir, "neovim", artifactName)
+	if err := os.MkdirAll(filepath.Dir(cachedArtifact), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachedArtifact, []byte("cross"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var devcontainer config.Devcontainer
+	devcontainer.Spec.RemoteUser = "user"
+
+	remote := &target.LocalDir{Root: filepath.Join(tempDir, "remote"), ArchName: config.ToolArch_aarch64}
+	if err := Setup(myConfig, devcontainer, remote, SetupOptions{SkipSelfBinary: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	shipped := filepath.Join(myConfig.Config.Remote.Workdir, "neovim", neovimShippedDir, artifactName)
+	if _, err := os.Stat(remote.Path(shipped)); err != nil {
+		t.Fatalf("expected host build to be shipped: %s", err)
+	}
+
+	lastExec := remote.Executed[len(remote.Executed)-1]
+	if !slices.Contains(lastExec.Args, "--prebuilt") {
+		t.Fatalf("expected remote setup to install the prebuilt neovim, got %v", lastExec.Args)
+	}
+}
@@ -0,0 +1,160 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+type LifecycleHook struct {
+	Name    string
+	Command config.LifecycleCommand
+	// Shell expression identifying when the hook last ran. The hook is skipped
+	// if it evaluates to the same value as the last time. Empty to always run.
+	RunOnce string
+}
+
+// The start time of the container init process (field 22 of /proc/1/stat,
+// after the command name which may have spaces) with the kernel boot id, so
+// it changes on every container start but not while it runs.
+const containerStartedKey = `$(sed 's/.*) //' /proc/1/stat | cut -d ' ' -f 20)-$(cat /proc/sys/kernel/random/boot_id)`
+
+// Hooks that run when the container is ready, in the devcontainer spec order.
+func StartLifecycleHooks(devcontainer config.Devcontainer) []LifecycleHook {
+	return []LifecycleHook{
+		{Name: "onCreateCommand", Command: devcontainer.Spec.OnCreateCommand, RunOnce: "created"},
+		{Name: "postCreateCommand", Command: devcontainer.Spec.PostCreateCommand, RunOnce: "created"},
+		{Name: "postStartCommand", Command: devcontainer.Spec.PostStartCommand, RunOnce: containerStartedKey},
+	}
+}
+
+func AttachLifecycleHooks(devcontainer config.Devcontainer) []LifecycleHook {
+	return []LifecycleHook{
+		{Name: "postAttachCommand", Command: devcontainer.Spec.PostAttachCommand},
+	}
+}
+
+func remoteContainerEnv(remote target.Target) (map[string]string, error) {
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"env"},
+		User: "root",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting container env: %w", err)
+	}
+
+	env := make(map[string]string)
+	for line := range strings.SplitSeq(output, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[key] = value
+		}
+	}
+
+	return env, nil
+}
+
+func RunLifecycleHooks(
+	myConfig config.Config,
+	devcontainer config.Devcontainer,
+	remote target.Target,
+	hooks []LifecycleHook,
+) error {
+	if !slices.ContainsFunc(hooks, func(hook LifecycleHook) bool { return len(hook.Command) > 0 }) {
+		return nil
+	}
+
+	containerEnv, err := remoteContainerEnv(remote)
+	if err != nil {
+		return err
+	}
+
+	workdir, err := devcontainer.ContainerWorkspaceFolder()
+	if err != nil {
+		return err
+	}
+
+	execParams := docker.ExecParams{
+		Env:     devcontainer.RemoteEnvList(containerEnv),
+		Stream:  true,
+		User:    devcontainer.Spec.RemoteUser,
+		Workdir: workdir,
+	}
+
+	markersDir := filepath.Join(myConfig.Remote.Workdir, "lifecycle")
+
+	for _, hook := range hooks {
+		if len(hook.Command) == 0 {
+			continue
+		}
+
+		marker := filepath.Join(markersDir, hook.Name)
+		if hook.RunOnce != "" {
+			output, err := remote.Exec(docker.ExecParams{
+				Args: []string{"sh", "-c", fmt.Sprintf(
+					`test "$(cat '%s' 2>/dev/null)" = "%s" && echo -n done || true`, marker, hook.RunOnce)},
+				User: "root",
+			})
+			if err != nil {
+				return err
+			}
+			if output == "done" {
+				slog.Debug("lifecycle command already ran", "hook", hook.Name)
+				continue
+			}
+		}
+
+		slog.Info("running lifecycle command", "hook", hook.Name)
+		if err := runLifecycleCommand(remote, execParams, hook.Command); err != nil {
+			return fmt.Errorf("%s failed: %w", hook.Name, err)
+		}
+
+		if hook.RunOnce != "" {
+			_, err := remote.Exec(docker.ExecParams{
+				Args: []string{"sh", "-c", fmt.Sprintf(
+					`mkdir -p '%s' && echo "%s" > '%s'`, markersDir, hook.RunOnce, marker)},
+				User: "root",
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func runLifecycleCommand(remote target.Target, execParams docker.ExecParams, command config.LifecycleCommand) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for name, args := range command {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			params := execParams
+			params.Args = args
+			_, err := remote.Exec(params)
+			if err != nil {
+				if name != "" {
+					err = fmt.Errorf("%s: %w", name, err)
+				}
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
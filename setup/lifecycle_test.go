@@ -0,0 +1,88 @@
+package setup
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestRunLifecycleHooks(t *testing.T) {
+	devcontainer, err := config.ParseDevcontainer([]byte(`{
+		"remoteUser": "user",
+		"workspaceFolder": "/code",
+		"remoteEnv": {"PATH": "${containerEnv:PATH}:/extra"},
+		"onCreateCommand": "echo created",
+		"postCreateCommand": ["make", "deps"],
+		"postStartCommand": {"a": "echo a", "b": "echo b"},
+		"postAttachCommand": "echo attached",
+	}`), "/src/project/.devcontainer.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var myConfig config.Config
+	myConfig.Remote.Workdir = "/opt/nvim-mindevc"
+
+	remote := &target.LocalDir{
+		Root: t.TempDir(),
+		ExecFunc: func(execParams docker.ExecParams) (string, error) {
+			switch {
+			case slices.Equal(execParams.Args, []string{"env"}):
+				return "PATH=/usr/bin\nHOME=/root\n", nil
+			// pretend the create hooks already ran
+			case strings.Contains(strings.Join(execParams.Args, " "), "Create") &&
+				strings.Contains(strings.Join(execParams.Args, " "), "&& echo -n done"):
+				return "done", nil
+			}
+			return "", nil
+		},
+	}
+
+	hooks := append(StartLifecycleHooks(devcontainer), AttachLifecycleHooks(devcontainer)...)
+	if err := RunLifecycleHooks(myConfig, devcontainer, remote, hooks); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var ran [][]string
+	for _, execParams := range remote.Executed {
+		if execParams.User != "user" {
+			continue
+		}
+		if execParams.Workdir != "/code" {
+			t.Errorf("expected workdir /code, got %q", execParams.Workdir)
+		}
+		if !slices.Equal(execParams.Env, []string{"PATH=/usr/bin:/extra"}) {
+			t.Errorf("unexpected env %v", execParams.Env)
+		}
+		ran = append(ran, execParams.Args)
+	}
+
+	if len(ran) != 3 {
+		t.Fatalf("expected 3 commands to run, got %v", ran)
+	}
+	slices.SortFunc(ran[:2], func(a, b []string) int { return strings.Compare(a[2], b[2]) })
+	want := [][]string{
+		{"/bin/sh", "-c", "echo a"},
+		{"/bin/sh", "-c", "echo b"},
+		{"/bin/sh", "-c", "echo attached"},
+	}
+	if !slices.EqualFunc(ran, want, slices.Equal) {
+		t.Fatalf("expected commands %v, got %v", want, ran)
+	}
+}
+
+func TestRunLifecycleHooks_NoHooks(t *testing.T) {
+	var devcontainer config.Devcontainer
+	remote := &target.LocalDir{Root: t.TempDir()}
+
+	if err := RunLifecycleHooks(config.Config{}, devcontainer, remote, StartLifecycleHooks(devcontainer)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(remote.Executed) > 0 {
+		t.Fatalf("expected nothing to be executed, got %v", remote.Executed)
+	}
+}
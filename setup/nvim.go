@@ -2,46 +2,156 @@ package setup
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
+	"github.com/davidrios/nvim-mindevc/config"
 	"github.com/davidrios/nvim-mindevc/utils"
 )
 
-func IsAlpine() (bool, error) {
+const (
+	LibcGlibc = "glibc"
+	LibcMusl  = "musl"
+)
+
+// Prints the libc of the system, for running in the target.
+const libcScript = `test -e /lib/ld-musl-$(uname -m).so.1 && echo musl || echo glibc`
+
+func hasMusl(arch string) bool {
+	_, err := os.Stat(fmt.Sprintf("/lib/ld-musl-%s.so.1", arch))
+	return err == nil
+}
+
+func Libc(arch config.ConfigToolArch) string {
+	if hasMusl(string(arch)) {
+		return LibcMusl
+	}
+	return LibcGlibc
+}
+
+func localArch() (string, error) {
 	cmd := exec.Command("uname", "-m")
 	output, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			slog.Debug("cmd error", "stderr", exitErr.Stderr)
 		}
-		return false, fmt.Errorf("error executing: %w", err)
+		return "", fmt.Errorf("error executing: %w", err)
 	}
-	_arch := strings.TrimSpace(string(output))
-	_, err = os.Stat(fmt.Sprintf("/lib/ld-musl-%s.so.1", _arch))
+	return strings.TrimSpace(string(output)), nil
+}
 
-	hasMusl := err == nil
+func IsAlpine() (bool, error) {
+	arch, err := localArch()
+	if err != nil {
+		return false, err
+	}
 
-	cmd = exec.Command("apk", "--version")
+	cmd := exec.Command("apk", "--version")
 	_, err = cmd.Output()
 
-	return hasMusl && err == nil, nil
+	return hasMusl(arch) && err == nil, nil
+}
+
+// The file name of a prebuilt neovim, binaries are only shared between
+// systems with the same architecture and libc. flavor identifies builds with
+// non default options.
+func NeovimArtifactName(tag string, arch config.ConfigToolArch, libc string, flavor string) string {
+	if flavor != "" {
+		return fmt.Sprintf("nvim-%s-linux-%s-%s-%s.tar", tag, arch, libc, flavor)
+	}
+	return fmt.Sprintf("nvim-%s-linux-%s-%s.tar", tag, arch, libc)
+}
+
+var buildModeArgs = map[string][]string{
+	"debug": {},
+	"safe":  {"--release=safe"},
+	"fast":  {"--release=fast"},
+	"small": {"--release=small"},
 }
 
-func DownloadAndExtractNeovim(workDir string, tag string, noCache bool) (string, error) {
+var defaultBuildArgs = []string{"build", "nvim", "--release=fast"}
+
+// The zig arguments to build neovim with.
+func BuildArgs(build config.ConfigNeovimBuild) ([]string, error) {
+	modeArgs, ok := buildModeArgs[build.Mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid neovim build mode '%s', must be one of debug, safe, fast or small", build.Mode)
+	}
+
+	args := append([]string{"build", "nvim"}, modeArgs...)
+	if build.Target != "" {
+		args = append(args, "-Dtarget="+build.Target)
+	}
+	return append(args, build.Args...), nil
+}
+
+// Identifies builds made with other than the default arguments.
+func buildFlavor(args []string) string {
+	if slices.Equal(args, defaultBuildArgs) {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(args, "\x00"))))[:8]
+}
+
+var (
+	neovimTagRe    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	neovimCommitRe = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+)
+
+// The source archive url for a neovim tag, like `nightly`, `stable` or
+// `v0.11.2`, or commit SHA.
+func NeovimSourceUrl(tag string) (string, error) {
+	if !neovimTagRe.MatchString(tag) {
+		return "", fmt.Errorf("invalid neovim tag '%s'", tag)
+	}
+	if neovimCommitRe.MatchString(tag) {
+		return fmt.Sprintf("https://github.com/neovim/neovim/archive/%s.tar.gz", tag), nil
+	}
+	return fmt.Sprintf("https://github.com/neovim/neovim/archive/refs/tags/%s.tar.gz", tag), nil
+}
+
+// Downloads and extracts the neovim sources of tag to `neovim-<tag>` inside
+// workDir. If hash is not empty the archive must have that sha256.
+func DownloadAndExtractNeovim(workDir string, tag string, hash string, noCache bool) (string, error) {
 	slog.Debug("downloading neovim", "tag", tag)
 
+	sourceUrl, err := NeovimSourceUrl(tag)
+	if err != nil {
+		return "", err
+	}
+
 	neovimSourceFile := filepath.Join(workDir, fmt.Sprintf("neovim-%s.tar.gz", tag))
+	if _, err := os.Stat(neovimSourceFile); err == nil && !noCache && hash != "" {
+		if gotHash, err := utils.Sha256File(neovimSourceFile); err != nil || gotHash != hash {
+			slog.Debug("cached neovim source doesn't match hash, downloading again")
+			noCache = true
+		}
+	}
+
 	if _, err := os.Stat(neovimSourceFile); err != nil || noCache {
 		tmpFile := neovimSourceFile + ".tmp"
-		err := utils.DownloadFileHttp(fmt.Sprintf("https://github.com/neovim/neovim/archive/refs/tags/%s.tar.gz", tag), tmpFile)
+		err := utils.DownloadFileHttp(sourceUrl, tmpFile)
 		if err != nil {
 			return "", err
 		}
+		if hash != "" {
+			gotHash, err := utils.Sha256File(tmpFile)
+			if err != nil {
+				return "", err
+			}
+			if gotHash != hash {
+				os.Remove(tmpFile)
+				return "", fmt.Errorf("neovim source hash does not match, expected %s, got %s", hash, gotHash)
+			}
+		}
 		err = os.Rename(tmpFile, neovimSourceFile)
 		if err != nil {
 			return "", err
@@ -59,48 +169,139 @@ func DownloadAndExtractNeovim(workDir string, tag string, noCache bool) (string,
 		return "", err
 	}
 
-	err = utils.ExtractTar(fileReader, workDir)
+	// the top folder of the archive depends on the tag or commit, like
+	// `neovim-0.11.2` for `v0.11.2`
+	neovimSrc := filepath.Join(workDir, "neovim-"+tag)
+	err = utils.ExtractTarStrip(fileReader, neovimSrc, 1)
 	if err != nil {
 		return "", fmt.Errorf("failed to extract tar: %w", err)
 	}
 
+	if err := writeCommit(filepath.Join(neovimSrc, neovimCommitFile), archiveCommit(neovimSourceFile)); err != nil {
+		return "", err
+	}
+
 	slog.Debug("downloaded and extracted")
-	neovimSrc := filepath.Join(workDir, "neovim-"+tag)
 
 	return neovimSrc, nil
 }
 
-func CompileNeovim(zigBin string, neovimSrc string) error {
+// Whether the neovim build in neovimSrc runs in this system.
+func NeovimWorks(neovimSrc string) bool {
 	nvimBin := filepath.Join(neovimSrc, "zig-out", "bin", "nvim")
 
 	cmd := exec.Command(nvimBin, "--clean", "-es", "-c", "call writefile(['hello'], '.imalive')")
 	cmd.Dir = neovimSrc
 	cmd.Env = append(cmd.Env, "VIM="+neovimSrc)
-	if err := cmd.Run(); err != nil {
-		slog.Info("compiling neovim, this may take a while...")
+	return cmd.Run() == nil
+}
+
+// Compiles neovim if there's no working build in neovimSrc.
+func CompileNeovim(zigBin string, neovimSrc string, build config.ConfigNeovimBuild) error {
+	if NeovimWorks(neovimSrc) {
+		return nil
+	}
+	return BuildNeovim(zigBin, neovimSrc, build)
+}
+
+// Compiles neovim with zig. Unless build.AllowSystemPackages is set, nothing
+// is installed in the system. musl systems then need an explicit
+// build.Target, as the native build needs the system compiler and libc
+// headers and a static build with zig's bundled musl can't load parsers.
+func BuildNeovim(zigBin string, neovimSrc string, build config.ConfigNeovimBuild) error {
+	buildArgs, err := BuildArgs(build)
+	if err != nil {
+		return err
+	}
 
-		isAlpine, err := IsAlpine()
+	if build.AllowSystemPackages {
+		installed, err := InstallBuildPackages()
+		if err != nil {
+			return fmt.Errorf("error compiling, %w", err)
+		}
+		if len(installed) > 0 {
+			slog.Info("installed system packages for the build", "packages", installed)
+		}
+	} else if build.Target == "" {
+		arch, err := localArch()
 		if err != nil {
 			return err
 		}
-		if isAlpine {
-			cmd = exec.Command("apk", "add", "gcc", "musl-dev")
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("error compiling, %w, %s", err, cmd.Stderr)
-			}
+		if hasMusl(arch) {
+			return fmt.Errorf("building neovim on musl needs the system compiler and libc headers, "+
+				"set neovim.build.allow_system_packages to install them, or neovim.build.target to %s-linux-musl "+
+				"for a static build that can't load treesitter parser libraries", arch)
 		}
+	}
 
-		cmd = exec.Command(zigBin, "build", "nvim", "--release=fast")
-		cmd.Dir = neovimSrc
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("error compiling, %w, %s", err, cmd.Stderr)
-		}
-		slog.Info("done")
+	slog.Info("compiling neovim, this may take a while...", "args", buildArgs)
+	if err := zigBuild(zigBin, neovimSrc, buildArgs); err != nil {
+		return err
+	}
+
+	return writeBuildArgs(neovimSrc, buildArgs)
+}
+
+func zigBuild(zigBin string, neovimSrc string, buildArgs []string) error {
+	cmd := exec.Command(zigBin, buildArgs...)
+	cmd.Dir = neovimSrc
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error compiling, %w", err)
 	}
+	slog.Info("done")
 
 	return nil
 }
 
+// Records the arguments of the build in neovimSrc.
+const neovimBuildArgsFile = ".nvim-mindevc-build"
+
+func writeBuildArgs(neovimSrc string, buildArgs []string) error {
+	return os.WriteFile(filepath.Join(neovimSrc, neovimBuildArgsFile), []byte(strings.Join(buildArgs, "\n")+"\n"), 0o644)
+}
+
+// The arguments neovimSrc was built with. Builds made before they were
+// recorded used the default ones.
+func readBuildArgs(neovimSrc string) []string {
+	data, err := os.ReadFile(filepath.Join(neovimSrc, neovimBuildArgsFile))
+	if err != nil {
+		return defaultBuildArgs
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// The paths of a neovim build that are needed to run it without the sources.
+var neovimBuildPaths = []string{"zig-out", "runtime"}
+
+// Packages the compiled binaries and the runtime files of a neovim build. The
+// commit of the build is written next to it, in `<destFile>.commit`.
 func TarNeovim(neovimSrc string, destFile string) error {
-	return nil
+	if err := utils.TarPaths(neovimSrc, neovimBuildPaths, destFile); err != nil {
+		os.Remove(destFile)
+		return fmt.Errorf("error packaging neovim: %w", err)
+	}
+	return writeCommit(destFile+".commit", readCommit(filepath.Join(neovimSrc, neovimCommitFile)))
+}
+
+// Replaces the build in neovimSrc with the one in artifact.
+func ExtractNeovimArtifact(artifact string, neovimSrc string) error {
+	fp, err := os.Open(artifact)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	for _, buildPath := range neovimBuildPaths {
+		if err := os.RemoveAll(filepath.Join(neovimSrc, buildPath)); err != nil {
+			return err
+		}
+	}
+
+	if err := utils.ExtractTar(fp, neovimSrc); err != nil {
+		return fmt.Errorf("error extracting prebuilt neovim: %w", err)
+	}
+
+	return writeCommit(filepath.Join(neovimSrc, neovimCommitFile), readCommit(artifact+".commit"))
 }
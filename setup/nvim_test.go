@@ -1,9 +1,18 @@
 package setup
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
 )
 
 func TestDownloadAndCompileNeovim(t *testing.T) {
@@ -17,7 +26,7 @@ func TestDownloadAndCompileNeovim(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %s", err)
 	}
 
-	neovimSrc, err := DownloadAndExtractNeovim(tempDir, "nightly", false)
+	neovimSrc, err := DownloadAndExtractNeovim(tempDir, "nightly", "", false)
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
@@ -27,8 +36,212 @@ func TestDownloadAndCompileNeovim(t *testing.T) {
 	}
 	zigBin := filepath.Join(tempDir, "bin", "zig")
 
-	err = CompileNeovim(zigBin, neovimSrc)
+	err = CompileNeovim(zigBin, neovimSrc, config.ConfigNeovimBuild{Mode: "fast"})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 }
+
+func TestTarNeovim(t *testing.T) {
+	tempDir := t.TempDir()
+	neovimSrc := filepath.Join(tempDir, "neovim-nightly")
+
+	for file, content := range map[string]string{
+		"zig-out/bin/nvim":        "binary",
+		"runtime/syntax/c.vim":    "syntax",
+		"src/nvim/main.c":         "source",
+		".zig-cache/o/abc/main.o": "object",
+	} {
+		filePath := filepath.Join(neovimSrc, file)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	artifact := filepath.Join(tempDir, NeovimArtifactName("nightly", "x86_64", LibcGlibc, ""))
+	if err := TarNeovim(neovimSrc, artifact); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	extracted := filepath.Join(tempDir, "extracted")
+	if err := ExtractNeovimArtifact(artifact, extracted); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testTable := []struct {
+		name string
+		file string
+		want bool
+	}{
+		{name: "binary", file: "zig-out/bin/nvim", want: true},
+		{name: "runtime", file: "runtime/syntax/c.vim", want: true},
+		{name: "sources", file: "src/nvim/main.c"},
+		{name: "zig cache", file: ".zig-cache/o/abc/main.o"},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			info, err := os.Stat(filepath.Join(extracted, tv.file))
+			if got := err == nil; got != tv.want {
+				t.Fatalf("expected %s to exist: %v", tv.file, tv.want)
+			}
+			if tv.want && info.Mode().Perm()&0o100 == 0 {
+				t.Fatalf("expected %s to keep its mode, got %s", tv.file, info.Mode())
+			}
+		})
+	}
+}
+
+func TestNeovimSourceUrl(t *testing.T) {
+	testTable := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{name: "nightly", tag: "nightly", want: "https://github.com/neovim/neovim/archive/refs/tags/nightly.tar.gz"},
+		{name: "stable", tag: "stable", want: "https://github.com/neovim/neovim/archive/refs/tags/stable.tar.gz"},
+		{name: "version", tag: "v0.11.2", want: "https://github.com/neovim/neovim/archive/refs/tags/v0.11.2.tar.gz"},
+		{name: "commit", tag: "a1b2c3d4e5", want: "https://github.com/neovim/neovim/archive/a1b2c3d4e5.tar.gz"},
+		{name: "path", tag: "../nightly", wantErr: true},
+		{name: "empty", tag: "", wantErr: true},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			got, err := NeovimSourceUrl(tv.tag)
+			if tv.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tv.want {
+				t.Fatalf("expected %s, got %s", tv.want, got)
+			}
+		})
+	}
+}
+
+func neovimSourceArchive(t *testing.T, topDir string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for _, header := range []*tar.Header{
+		{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "abc"}},
+		{Name: topDir + "/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: topDir + "/build.zig", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5},
+	} {
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tarWriter.Write([]byte("build")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+	return buf.Bytes()
+}
+
+func TestDownloadAndExtractNeovim_Tags(t *testing.T) {
+	archive := neovimSourceArchive(t, "neovim-0.11.2")
+	archiveHash := fmt.Sprintf("%x", sha256.Sum256(archive))
+	useFakeTransport(t, fakeTransport{
+		"https://github.com/neovim/neovim/archive/refs/tags/v0.11.2.tar.gz": archive,
+	})
+
+	testTable := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{name: "no hash"},
+		{name: "matching hash", hash: archiveHash},
+		{name: "wrong hash", hash: strings.Repeat("0", 64), wantErr: true},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			neovimSrc, err := DownloadAndExtractNeovim(tempDir, "v0.11.2", tv.hash, false)
+			if tv.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if neovimSrc != filepath.Join(tempDir, "neovim-v0.11.2") {
+				t.Fatalf("unexpected source dir %s", neovimSrc)
+			}
+			if _, err := os.Stat(filepath.Join(neovimSrc, "build.zig")); err != nil {
+				t.Fatalf("expected sources to be extracted: %s", err)
+			}
+		})
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	testTable := []struct {
+		name       string
+		build      config.ConfigNeovimBuild
+		want       []string
+		wantFlavor bool
+		wantErr    bool
+	}{
+		{name: "default", build: config.ConfigNeovimBuild{Mode: "fast"}, want: []string{"build", "nvim", "--release=fast"}},
+		{name: "debug", build: config.ConfigNeovimBuild{Mode: "debug"}, want: []string{"build", "nvim"}, wantFlavor: true},
+		{
+			name:       "static",
+			build:      config.ConfigNeovimBuild{Mode: "small", Target: "x86_64-linux-musl", Args: []string{"-Dluajit=false"}},
+			want:       []string{"build", "nvim", "--release=small", "-Dtarget=x86_64-linux-musl", "-Dluajit=false"},
+			wantFlavor: true,
+		},
+		{name: "invalid mode", build: config.ConfigNeovimBuild{Mode: "turbo"}, wantErr: true},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			got, err := BuildArgs(tv.build)
+			if tv.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !slices.Equal(got, tv.want) {
+				t.Fatalf("expected %v, got %v", tv.want, got)
+			}
+			if flavor := buildFlavor(got); (flavor != "") != tv.wantFlavor {
+				t.Fatalf("unexpected flavor %q", flavor)
+			}
+		})
+	}
+}
+
+func TestBuildArgs_Recorded(t *testing.T) {
+	neovimSrc := t.TempDir()
+	if got := readBuildArgs(neovimSrc); !slices.Equal(got, defaultBuildArgs) {
+		t.Fatalf("expected default args for builds without record, got %v", got)
+	}
+
+	args := []string{"build", "nvim", "-Dfoo=a b"}
+	if err := writeBuildArgs(neovimSrc, args); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := readBuildArgs(neovimSrc); !slices.Equal(got, args) {
+		t.Fatalf("expected %v, got %v", args, got)
+	}
+}
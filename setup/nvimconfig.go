@@ -0,0 +1,173 @@
+package setup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/git"
+	"github.com/davidrios/nvim-mindevc/utils"
+)
+
+func isConfigArchive(path string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a config uri is a local folder, the only kind that can be watched.
+func IsLocalConfigFolder(configUri string) bool {
+	return strings.HasPrefix(configUri, "file://") && !isConfigArchive(configUri)
+}
+
+func verifyConfigHash(archive string, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	gotHash, err := utils.Sha256File(archive)
+	if err != nil {
+		return err
+	}
+	if gotHash != hash {
+		return fmt.Errorf("neovim config hash does not match, expected %s, got %s", hash, gotHash)
+	}
+	return nil
+}
+
+// Extracts a config archive to destDir, the type is taken from the extension
+// of name. Archives with a single top folder, like the ones from github, are
+// extracted without it. Returns the config folder.
+func extractConfigArchive(archive string, name string, destDir string) (string, error) {
+	if strings.HasSuffix(name, ".zip") {
+		if err := utils.ExtractZip(archive, destDir); err != nil {
+			return "", err
+		}
+	} else {
+		fp, err := os.Open(archive)
+		if err != nil {
+			return "", err
+		}
+		defer fp.Close()
+
+		var reader io.Reader = fp
+		if !strings.HasSuffix(name, ".tar") {
+			gzReader, err := gzip.NewReader(fp)
+			if err != nil {
+				return "", err
+			}
+			reader = gzReader
+		}
+
+		if err := utils.ExtractTar(reader, destDir); err != nil {
+			return "", fmt.Errorf("failed to extract tar: %w", err)
+		}
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(destDir, entries[0].Name()), nil
+	}
+
+	return destDir, nil
+}
+
+// Clones the repository of a `git+<scheme>://...#<ref>` or `git://` uri to
+// destDir, at ref if set, which can be a branch, a tag or a commit.
+func cloneConfigRepo(rawUri string, destDir string) error {
+	repoUrl, ref, _ := strings.Cut(strings.TrimPrefix(rawUri, "git+"), "#")
+
+	if ref == "" || neovimCommitRe.MatchString(ref) {
+		if err := git.Clone(git.CloneOptions{Directory: destDir, Url: repoUrl}); err != nil {
+			return err
+		}
+		if ref == "" {
+			return nil
+		}
+		return git.Checkout(destDir, git.CheckoutOptions{Branch: ref})
+	}
+
+	var err error
+	for _, refName := range []string{"refs/heads/" + ref, "refs/tags/" + ref} {
+		if err = os.RemoveAll(destDir); err != nil {
+			return err
+		}
+		err = git.Clone(git.CloneOptions{Directory: destDir, Url: repoUrl, Branch: refName})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("error cloning %s at %s: %w", repoUrl, ref, err)
+}
+
+// Gets the neovim config of the config uri to a local folder. It can be a
+// folder or archive with a `file://` uri, a git repository with a `git://`
+// or `git+<scheme>://` uri and an optional `#<ref>`, or an https archive,
+// which must have a configured hash. The returned function removes any
+// temporary files, it must always be called.
+func NeovimConfigDir(myConfig config.Config, cacheDir string) (string, func(), error) {
+	cleanup := func() {}
+
+	configUri, err := myConfig.GetConfigURI()
+	if err != nil {
+		return "", cleanup, err
+	}
+	slog.Debug("got config uri", "uri", configUri, "scheme", configUri.Scheme)
+
+	tmpDir, err := os.MkdirTemp("", "nvim-mindevc-config-")
+	if err != nil {
+		return "", cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+
+	switch {
+	case configUri.Scheme == "file":
+		configPath, err := config.ExpandHome(myConfig.Neovim.ConfigURI[len("file://"):])
+		if err != nil {
+			return "", cleanup, err
+		}
+		if !isConfigArchive(configPath) {
+			return configPath, cleanup, nil
+		}
+		if err := verifyConfigHash(configPath, myConfig.Neovim.ConfigHash); err != nil {
+			return "", cleanup, err
+		}
+		configPath, err = extractConfigArchive(configPath, configPath, tmpDir)
+		return configPath, cleanup, err
+
+	case configUri.Scheme == "git" || strings.HasPrefix(configUri.Scheme, "git+"):
+		configPath := filepath.Join(tmpDir, "nvim")
+		if err := cloneConfigRepo(myConfig.Neovim.ConfigURI, configPath); err != nil {
+			return "", cleanup, err
+		}
+		return configPath, cleanup, nil
+
+	case configUri.Scheme == "https" && isConfigArchive(configUri.Path):
+		if myConfig.Neovim.ConfigHash == "" {
+			return "", cleanup, fmt.Errorf("neovim.config_hash is required for https config archives")
+		}
+
+		downloadDir := filepath.Join(cacheDir, "config")
+		if err := os.MkdirAll(downloadDir, 0o755); err != nil {
+			return "", cleanup, err
+		}
+		archive, err := DownloadToolHttp(downloadDir, myConfig.Neovim.ConfigURI, configUri, myConfig.Neovim.ConfigHash)
+		if err != nil {
+			return "", cleanup, fmt.Errorf("error downloading neovim config: %w", err)
+		}
+		configPath, err := extractConfigArchive(archive, configUri.Path, tmpDir)
+		return configPath, cleanup, err
+	}
+
+	return "", cleanup, fmt.Errorf("invalid nvim config uri %s", myConfig.Neovim.ConfigURI)
+}
@@ -0,0 +1,108 @@
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+)
+
+func configArchive(t *testing.T, topDir string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	content := "return {}\n"
+	for _, header := range []*tar.Header{
+		{Name: topDir + "/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: topDir + "/init.lua", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))},
+	} {
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tarWriter.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNeovimConfigDir(t *testing.T) {
+	dir := t.TempDir()
+
+	configDir := filepath.Join(dir, "nvim")
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "init.lua"), []byte("return {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := configArchive(t, "dotfiles-main")
+	archiveHash := fmt.Sprintf("%x", sha256.Sum256(archive))
+	archiveFile := filepath.Join(dir, "config.tar.gz")
+	if err := os.WriteFile(archiveFile, archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useFakeTransport(t, fakeTransport{"https://example.com/config.tar.gz": archive})
+
+	repoDir := filepath.Join(dir, "repo")
+	commit := testPluginRepo(t, repoDir)
+
+	testTable := []struct {
+		name    string
+		uri     string
+		hash    string
+		wantErr bool
+	}{
+		{name: "folder", uri: "file://" + configDir},
+		{name: "file archive", uri: "file://" + archiveFile},
+		{name: "file archive with hash", uri: "file://" + archiveFile, hash: archiveHash},
+		{name: "file archive wrong hash", uri: "file://" + archiveFile, hash: strings.Repeat("0", 64), wantErr: true},
+		{name: "https archive", uri: "https://example.com/config.tar.gz", hash: archiveHash},
+		{name: "https archive without hash", uri: "https://example.com/config.tar.gz", wantErr: true},
+		{name: "https archive wrong hash", uri: "https://example.com/config.tar.gz", hash: strings.Repeat("0", 64), wantErr: true},
+		{name: "git", uri: "git+file://" + repoDir},
+		{name: "git branch", uri: "git+file://" + repoDir + "#master"},
+		{name: "git commit", uri: "git+file://" + repoDir + "#" + commit},
+		{name: "git missing branch", uri: "git+file://" + repoDir + "#nope", wantErr: true},
+		{name: "unsupported", uri: "ftp://example.com/config", wantErr: true},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var myConfig config.Config
+			myConfig.Neovim.ConfigURI = tv.uri
+			myConfig.Neovim.ConfigHash = tv.hash
+
+			configPath, cleanup, err := NeovimConfigDir(myConfig, filepath.Join(dir, "cache"))
+			defer cleanup()
+			if tv.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(configPath, "init.lua")); err != nil {
+				t.Fatalf("no init.lua in config: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package setup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+type packageManager struct {
+	Name string
+	// Command that succeeds if a package is installed
+	Check []string
+	// Command to run before installing, like refreshing the indexes
+	Prepare []string
+	Install []string
+	// Packages needed to compile against the system libc
+	BuildPackages []string
+}
+
+var packageManagers = []packageManager{
+	{
+		Name:          "apk",
+		Check:         []string{"apk", "info", "-e"},
+		Install:       []string{"apk", "add", "--no-cache"},
+		BuildPackages: []string{"gcc", "musl-dev"},
+	},
+	{
+		Name:          "apt-get",
+		Check:         []string{"dpkg", "-s"},
+		Prepare:       []string{"apt-get", "update"},
+		Install:       []string{"apt-get", "install", "-y", "--no-install-recommends"},
+		BuildPackages: []string{"gcc", "libc6-dev"},
+	},
+	{
+		Name:          "dnf",
+		Check:         []string{"rpm", "-q"},
+		Install:       []string{"dnf", "install", "-y"},
+		BuildPackages: []string{"gcc", "glibc-devel"},
+	},
+	{
+		Name:          "yum",
+		Check:         []string{"rpm", "-q"},
+		Install:       []string{"yum", "install", "-y"},
+		BuildPackages: []string{"gcc", "glibc-devel"},
+	},
+}
+
+func detectPackageManager() (packageManager, error) {
+	for _, manager := range packageManagers {
+		if _, err := exec.LookPath(manager.Name); err == nil {
+			return manager, nil
+		}
+	}
+	return packageManager{}, fmt.Errorf("no supported package manager found (apk, apt-get, dnf or yum)")
+}
+
+func runPackageManager(args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Installs the missing packages needed to compile against the system libc
+// with the system package manager. Returns the packages that were installed.
+func InstallBuildPackages() ([]string, error) {
+	manager, err := detectPackageManager()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, pkg := range manager.BuildPackages {
+		cmd := exec.Command(manager.Check[0], append(manager.Check[1:], pkg)...)
+		if err := cmd.Run(); err != nil {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	slog.Info("installing system packages", "manager", manager.Name, "packages", missing)
+	if len(manager.Prepare) > 0 {
+		if err := runPackageManager(manager.Prepare); err != nil {
+			return nil, fmt.Errorf("error running %s: %w", manager.Name, err)
+		}
+	}
+	if err := runPackageManager(append(manager.Install, missing...)); err != nil {
+		return nil, fmt.Errorf("error installing %v with %s: %w", missing, manager.Name, err)
+	}
+
+	return missing, nil
+}
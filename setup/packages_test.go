@@ -0,0 +1,50 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstallBuildPackages(t *testing.T) {
+	binDir := t.TempDir()
+	logFile := filepath.Join(binDir, "apk.log")
+
+	// gcc is installed, musl-dev isn't
+	fakeApk := `#!/bin/sh
+if [ "$1" = info ]; then
+	[ "$3" = gcc ]
+	exit
+fi
+echo "$@" >> ` + logFile + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "apk"), []byte(fakeApk), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+":/bin:/usr/bin")
+
+	installed, err := InstallBuildPackages()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !slices.Equal(installed, []string{"musl-dev"}) {
+		t.Fatalf("expected musl-dev to be installed, got %v", installed)
+	}
+
+	log, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.TrimSpace(string(log)) != "add --no-cache musl-dev" {
+		t.Fatalf("unexpected apk calls %q", log)
+	}
+}
+
+func TestInstallBuildPackages_NoManager(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	if _, err := InstallBuildPackages(); err == nil {
+		t.Fatal("expected error without a package manager")
+	}
+}
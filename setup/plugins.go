@@ -0,0 +1,244 @@
+package setup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/git"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+type systemUser struct {
+	Name  string
+	Uid   uint32
+	Gid   uint32
+	Home  string
+	Shell string
+}
+
+func lookupUser(name string) (systemUser, error) {
+	output, err := exec.Command("getent", "passwd", name).Output()
+	if err != nil {
+		return systemUser{}, fmt.Errorf("error getting user %s: %w", name, err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(string(output)), ":")
+	if len(fields) < 7 {
+		return systemUser{}, fmt.Errorf("invalid passwd entry for user %s", name)
+	}
+
+	uid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return systemUser{}, fmt.Errorf("invalid uid for user %s: %w", name, err)
+	}
+	gid, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return systemUser{}, fmt.Errorf("invalid gid for user %s: %w", name, err)
+	}
+
+	return systemUser{Name: fields[0], Uid: uint32(uid), Gid: uint32(gid), Home: fields[5], Shell: fields[6]}, nil
+}
+
+// Runs the neovim of the runscript headless as the remote user, to install
+// the plugins of its config. The tools and the git emulation of the remote
+// workdir come first in PATH.
+func SyncPlugins(myConfig config.Config) error {
+	user, err := lookupUser(myConfig.Remote.User)
+	if err != nil {
+		return err
+	}
+	if user.Home == "/" || user.Home == "" {
+		return fmt.Errorf("error getting remote user home")
+	}
+
+	args := append([]string{"--headless"}, myConfig.Neovim.Plugins.SyncArgs...)
+
+	cmd := exec.Command(myConfig.Neovim.Runscript, args...)
+	cmd.Dir = user.Home
+	cmd.Env = append(os.Environ(),
+		"HOME="+user.Home,
+		"USER="+user.Name,
+		"PATH="+filepath.Join(myConfig.Remote.Workdir, "bin")+":"+os.Getenv("PATH"),
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if user.Uid != uint32(os.Getuid()) {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: user.Uid, Gid: user.Gid},
+		}
+	}
+
+	slog.Info("installing neovim plugins", "user", user.Name)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf(
+			"plugin sync failed: %w, run `%s %s` as %s in the container to see the details",
+			err, myConfig.Neovim.Runscript, strings.Join(quoteArgs(args), " "), user.Name)
+	}
+
+	return nil
+}
+
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return quoted
+}
+
+type lazyLockEntry struct {
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+}
+
+func readLazyLock(lockFile string) (map[string]lazyLockEntry, error) {
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock map[string]lazyLockEntry
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", lockFile, err)
+	}
+
+	return lock, nil
+}
+
+// The folder where lazy.nvim installs the plugins in this system.
+func hostLazyDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "nvim", "lazy"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "nvim", "lazy"), nil
+}
+
+// The repository of a plugin, from the config or from the plugin installed
+// on the host. Empty if not found.
+func pluginUrl(plugins config.ConfigNeovimPlugins, lazyDir string, name string) string {
+	// config keys are lowercased
+	for key, url := range plugins.Urls {
+		if strings.EqualFold(key, name) {
+			return url
+		}
+	}
+
+	url, err := git.RemoteUrl(filepath.Join(lazyDir, name), "origin")
+	if err != nil {
+		return ""
+	}
+	return url
+}
+
+func clonePlugin(url string, commit string, dir string) error {
+	tmpDir := dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := git.Clone(git.CloneOptions{Directory: tmpDir, Url: url}); err != nil {
+		return err
+	}
+	if err := git.Checkout(tmpDir, git.CheckoutOptions{Branch: commit}); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDir, dir)
+}
+
+// Clones the plugins locked in a lazy-lock.json file into the cache, one
+// folder per plugin and commit. Returns the cached folders by plugin name.
+// Plugins that can't be cached are left for the plugin manager to install.
+func CachePlugins(myConfig config.Config, cacheDir string, lockFile string) (map[string]string, error) {
+	lock, err := readLazyLock(lockFile)
+	if os.IsNotExist(err) {
+		slog.Warn("no lazy-lock.json in the neovim config, not caching plugins")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	lazyDir, err := hostLazyDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(lock)) {
+		commit := lock[name].Commit
+		if name != filepath.Base(name) || name == ".." || !neovimCommitRe.MatchString(commit) {
+			slog.Warn("invalid lazy-lock.json entry, not caching plugin", "name", name, "commit", commit)
+			continue
+		}
+
+		dir := filepath.Join(cacheDir, "plugins", name, commit)
+		if _, err := os.Stat(dir); err != nil {
+			url := pluginUrl(myConfig.Neovim.Plugins, lazyDir, name)
+			if url == "" {
+				slog.Warn("plugin repository unknown, add it to neovim.plugins.urls to cache it", "name", name)
+				continue
+			}
+
+			slog.Info("caching plugin", "name", name, "commit", commit)
+			if err := clonePlugin(url, commit, dir); err != nil {
+				slog.Warn("could not cache plugin", "name", name, "error", err)
+				continue
+			}
+		}
+
+		cached[name] = dir
+	}
+
+	return cached, nil
+}
+
+// Copies cached plugins to the lazy.nvim folder of the remote user, except
+// the ones already installed there.
+func shipPlugins(remote target.Target, remoteHome string, user string, cached map[string]string) error {
+	if len(cached) == 0 {
+		return nil
+	}
+
+	lazyDir := filepath.Join(remoteHome, ".local", "share", "nvim", "lazy")
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"sh", "-c", fmt.Sprintf("mkdir -p '%s' && ls -A '%s'", lazyDir, lazyDir)},
+		User: "root",
+	})
+	if err != nil {
+		return fmt.Errorf("error listing remote plugins: %w", err)
+	}
+	installed := strings.Fields(output)
+
+	for _, name := range slices.Sorted(maps.Keys(cached)) {
+		if slices.Contains(installed, name) {
+			slog.Debug("plugin already installed in remote", "name", name)
+			continue
+		}
+		if err := remote.CopyTo(cached[name], filepath.Join(lazyDir, name), target.CopyOptions{}); err != nil {
+			return err
+		}
+		slog.Debug("copied plugin to remote", "name", name)
+	}
+
+	_, err = remote.Exec(docker.ExecParams{
+		Args: []string{"chown", "-R", user, filepath.Join(remoteHome, ".local")},
+		User: "root",
+	})
+	return err
+}
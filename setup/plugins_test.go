@@ -0,0 +1,215 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/git"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestLookupUser(t *testing.T) {
+	current, err := osuser.Current()
+	if err != nil {
+		t.Skip("no current user")
+	}
+
+	user, err := lookupUser(current.Username)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if user.Home != current.HomeDir {
+		t.Fatalf("expected home %s, got %s", current.HomeDir, user.Home)
+	}
+
+	if _, err := lookupUser("nvim-mindevc-no-such-user"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSyncPlugins(t *testing.T) {
+	current, err := osuser.Current()
+	if err != nil || current.HomeDir == "/" {
+		t.Skip("no current user home")
+	}
+
+	testTable := []struct {
+		name     string
+		exitCode int
+		wantErr  bool
+	}{
+		{name: "success"},
+		{name: "failure", exitCode: 1, wantErr: true},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logFile := filepath.Join(dir, "nvim.log")
+			runscript := filepath.Join(dir, "nvim")
+			script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > '%s'\necho \"$PATH\" >> '%s'\nexit %d\n",
+				logFile, logFile, tv.exitCode)
+			if err := os.WriteFile(runscript, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			var myConfig config.Config
+			myConfig.Remote.User = current.Username
+			myConfig.Remote.Workdir = filepath.Join(dir, "workdir")
+			myConfig.Neovim.Runscript = runscript
+			myConfig.Neovim.Plugins.SyncArgs = []string{"+Lazy! sync", "+qa"}
+
+			err := SyncPlugins(myConfig)
+			if tv.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "'+Lazy! sync'") {
+					t.Fatalf("expected error with the command, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			log, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(log), "\n")
+			if lines[0] != "--headless +Lazy! sync +qa" {
+				t.Fatalf("unexpected args: %s", lines[0])
+			}
+			if !strings.HasPrefix(lines[1], filepath.Join(myConfig.Remote.Workdir, "bin")+":") {
+				t.Fatalf("workdir bin not first in PATH: %s", lines[1])
+			}
+		})
+	}
+}
+
+// Creates a repository with one commit, returns the commit.
+func testPluginRepo(t *testing.T, dir string) string {
+	t.Helper()
+	r, err := gogit.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "init.lua"), []byte("return {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Add("init.lua"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := tree.Commit("init", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestCachePlugins(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	configuredCommit := testPluginRepo(t, filepath.Join(dir, "repos", "Configured.nvim"))
+	hostCommit := testPluginRepo(t, filepath.Join(dir, "repos", "host.nvim"))
+
+	// installed on the host, the url comes from its origin
+	err := git.Clone(git.CloneOptions{
+		Directory: filepath.Join(dir, "data", "nvim", "lazy", "host.nvim"),
+		Url:       filepath.Join(dir, "repos", "host.nvim"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockFile := filepath.Join(dir, "lazy-lock.json")
+	lock := fmt.Sprintf(`{
+  "Configured.nvim": { "branch": "master", "commit": "%s" },
+  "host.nvim": { "branch": "master", "commit": "%s" },
+  "unknown.nvim": { "branch": "main", "commit": "%s" },
+  "../bad": { "branch": "main", "commit": "%s" }
+}`, configuredCommit, hostCommit, hostCommit, hostCommit)
+	if err := os.WriteFile(lockFile, []byte(lock), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var myConfig config.Config
+	myConfig.Neovim.Plugins.Urls = map[string]string{
+		"configured.nvim": filepath.Join(dir, "repos", "Configured.nvim"),
+	}
+
+	cacheDir := filepath.Join(dir, "cache")
+	cached, err := CachePlugins(myConfig, cacheDir, lockFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testTable := []struct {
+		name   string
+		commit string
+	}{
+		{name: "Configured.nvim", commit: configuredCommit},
+		{name: "host.nvim", commit: hostCommit},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			expected := filepath.Join(cacheDir, "plugins", tv.name, tv.commit)
+			if cached[tv.name] != expected {
+				t.Fatalf("expected %s, got %s", expected, cached[tv.name])
+			}
+			if _, err := os.Stat(filepath.Join(expected, "init.lua")); err != nil {
+				t.Fatalf("plugin not checked out: %s", err)
+			}
+		})
+	}
+	if len(cached) != 2 {
+		t.Fatalf("unexpected cached plugins: %v", cached)
+	}
+
+	// cached plugins don't need their repository anymore
+	if err := os.RemoveAll(filepath.Join(dir, "repos")); err != nil {
+		t.Fatal(err)
+	}
+	cached, err = CachePlugins(myConfig, cacheDir, lockFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cached) != 2 {
+		t.Fatalf("unexpected cached plugins: %v", cached)
+	}
+
+	remote := &target.LocalDir{
+		Root: filepath.Join(dir, "remote"),
+		ExecFunc: func(execParams docker.ExecParams) (string, error) {
+			if execParams.Args[0] == "sh" {
+				return "host.nvim\n", nil
+			}
+			return "", nil
+		},
+	}
+	if err := shipPlugins(remote, "/home/vscode", "vscode", cached); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lazyDir := remote.Path("/home/vscode/.local/share/nvim/lazy")
+	if _, err := os.Stat(filepath.Join(lazyDir, "Configured.nvim", "init.lua")); err != nil {
+		t.Fatalf("plugin not shipped: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(lazyDir, "host.nvim")); err == nil {
+		t.Fatalf("installed plugin shipped again")
+	}
+}
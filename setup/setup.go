@@ -14,45 +14,70 @@ import (
 
 	"github.com/davidrios/nvim-mindevc/config"
 	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
 	"github.com/davidrios/nvim-mindevc/utils"
 )
 
-func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSelfBinary bool) error {
-	if devcontainer.Spec.DockerComposeFile == "" {
-		return fmt.Errorf("dockerComposeFile property from devcontainer file must not be empty")
+// Starts the target if configured to and runs the start lifecycle commands.
+// The returned function stops the target again if it was started here and
+// the devcontainer shutdownAction asks for it, editing sessions call it when
+// they end.
+func StartTarget(myConfig config.Config, devcontainer config.Devcontainer, remote target.Target) (func(), error) {
+	stop := func() {}
+
+	if myConfig.Container.Up {
+		starter, ok := remote.(target.Starter)
+		if !ok {
+			return stop, fmt.Errorf("starting the devcontainer is only supported for compose devcontainers")
+		}
+
+		started, err := starter.Start(myConfig.Container.UpTimeout)
+		if started && devcontainer.ShutdownAction() == config.ShutdownActionStopCompose {
+			stop = func() {
+				if err := starter.Stop(); err != nil {
+					slog.Warn("error stopping devcontainer", "error", err)
+				}
+			}
+		}
+		if err != nil {
+			return stop, err
+		}
 	}
 
-	if devcontainer.Spec.Service == "" {
-		return fmt.Errorf("service property from devcontainer file must not be empty")
+	if !myConfig.Container.SkipLifecycle {
+		err := RunLifecycleHooks(myConfig, devcontainer, remote, StartLifecycleHooks(devcontainer))
+		if err != nil {
+			return stop, err
+		}
 	}
 
+	return stop, nil
+}
+
+type SetupOptions struct {
+	// Don't copy this binary to the target even if it's compatible
+	SkipSelfBinary bool
+	// Show the debug output of the remote setup
+	Verbose bool
+	BuildMode
+}
+
+func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, remote target.Target, options SetupOptions) error {
 	if devcontainer.Spec.RemoteUser == "" {
 		return fmt.Errorf("remoteUser property from devcontainer file must not be empty")
 	}
 
-	composeFile, err := docker.LoadComposeFile(devcontainer)
-	if err != nil {
-		return fmt.Errorf("error loading compose file: %w", err)
-	}
-	slog.Debug("composeFile", "v", composeFile)
-
-	serviceName := devcontainer.Spec.Service
-	if _, ok := composeFile.Spec.Services[serviceName]; !ok {
-		return fmt.Errorf("compose file does not contain service '%s'", serviceName)
+	// shutdownAction applies when an editing session ends, the target is
+	// left running after the setup
+	if _, err := StartTarget(myConfig.Config, devcontainer, remote); err != nil {
+		return err
 	}
 
-	_arch, err := composeFile.Exec(serviceName, docker.ExecParams{
-		Args: []string{"uname", "-m"},
-		User: "root",
-	})
+	arch, err := remote.Arch()
 	if err != nil {
 		return err
 	}
 
-	_arch = strings.TrimSpace(_arch)
-	slog.Debug("container arch", "v", _arch)
-	arch := config.ConfigToolArch(_arch)
-
 	withNvimMindevcTools := config.WithNvimMindevcTool(myConfig.Config)
 
 	cacheDir, err := config.ExpandHome(myConfig.Config.CacheDir)
@@ -70,7 +95,7 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 	}
 
 	uploadDir := filepath.Join(myConfig.Config.Remote.Workdir, "tools", "_download")
-	_, err = composeFile.Exec(serviceName, docker.ExecParams{
+	_, err = remote.Exec(docker.ExecParams{
 		Args: []string{"mkdir", "-p", uploadDir},
 		User: "root",
 	})
@@ -79,19 +104,19 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 	}
 
 	for toolName, downloadedFile := range downloaded {
-		err = composeFile.CpToService(serviceName, downloadedFile, filepath.Join(uploadDir, filepath.Base(downloadedFile)), docker.CpToServiceOptions{})
+		err = remote.CopyTo(downloadedFile, filepath.Join(uploadDir, filepath.Base(downloadedFile)), target.CopyOptions{})
 		if err != nil {
 			return err
 		}
 		if uncFile, _ := UncompressTool(myConfig.Config.Tools[toolName].Archives[arch].Type, downloadedFile); uncFile != "" {
-			_ = composeFile.CpToService(serviceName, uncFile, filepath.Join(uploadDir, filepath.Base(uncFile)), docker.CpToServiceOptions{})
+			_ = remote.CopyTo(uncFile, filepath.Join(uploadDir, filepath.Base(uncFile)), target.CopyOptions{})
 		}
 		slog.Debug("copied tool to remote", "file", downloadedFile)
 	}
 
 	remoteBinary := filepath.Join(uploadDir, "nvim-mindevc")
 
-	if !skipSelfBinary {
+	if !options.SkipSelfBinary {
 		cmd := exec.Command("uname", "-sm")
 		output, err := cmd.Output()
 		if err != nil {
@@ -99,12 +124,12 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 		}
 
 		osArch := strings.TrimSpace(string(output))
-		if osArch == fmt.Sprintf("Linux %s", _arch) {
+		if osArch == fmt.Sprintf("Linux %s", arch) {
 			myPath, err := os.Executable()
 			if err != nil {
 				return fmt.Errorf("could not get current binary: %w", err)
 			}
-			err = composeFile.CpToService(serviceName, myPath, remoteBinary, docker.CpToServiceOptions{})
+			err = remote.CopyTo(myPath, remoteBinary, target.CopyOptions{})
 			if err != nil {
 				return err
 			}
@@ -114,7 +139,7 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 		}
 	}
 
-	_, err = composeFile.Exec(serviceName, docker.ExecParams{
+	_, err = remote.Exec(docker.ExecParams{
 		Args: []string{"chmod", "+x", remoteBinary},
 		User: "root",
 	})
@@ -140,7 +165,7 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 		return fmt.Errorf("unexpected error: %s", err)
 	}
 	remoteConfig := filepath.Join(myConfig.Config.Remote.Workdir, "config.yaml")
-	err = composeFile.CpToService(serviceName, file.Name(), remoteConfig, docker.CpToServiceOptions{})
+	err = remote.CopyTo(file.Name(), remoteConfig, target.CopyOptions{})
 	if err != nil {
 		return err
 	}
@@ -156,81 +181,232 @@ func Setup(myConfig config.ConfigViper, devcontainer config.Devcontainer, skipSe
 	if err != nil {
 		return fmt.Errorf("error downloading cacerts: %w", err)
 	}
-	err = composeFile.CpToService(serviceName, file.Name(), filepath.Join(myConfig.Config.Remote.Workdir, "cacert.pem"), docker.CpToServiceOptions{})
+	err = remote.CopyTo(file.Name(), filepath.Join(myConfig.Config.Remote.Workdir, "cacert.pem"), target.CopyOptions{})
 	if err != nil {
 		return err
 	}
 
-	output, err := composeFile.Exec(serviceName, docker.ExecParams{
-		Args: []string{"sh", "-l", "-c", "echo $HOME"},
-		User: devcontainer.Spec.RemoteUser,
-	})
+	remoteHome, err := remote.Home(devcontainer.Spec.RemoteUser)
 	if err != nil {
-		return fmt.Errorf("error getting remote user home: %w", err)
+		return err
 	}
-	remoteHome := strings.TrimSpace(output)
-	if remoteHome == "/" {
-		return fmt.Errorf("error getting remote user home, got '/'")
+
+	configPath, cleanupConfig, err := NeovimConfigDir(myConfig.Config, cacheDir)
+	defer cleanupConfig()
+	if err != nil {
+		return err
 	}
+	slog.Debug("nvim config path", "p", configPath)
 
-	configUri, err := myConfig.Config.GetConfigURI()
+	_, err = SyncNeovimConfig(remote, configPath, remoteHome, devcontainer.Spec.RemoteUser, ConfigSyncOptions{
+		Strategy: myConfig.Config.Neovim.ConfigSync,
+		Mount:    myConfig.Config.Neovim.ConfigMount,
+	})
 	if err != nil {
+		return fmt.Errorf("error syncing neovim config: %w", err)
+	}
+
+	if err := CopyFiles(myConfig.Config, remote, remoteHome, devcontainer.Spec.RemoteUser, cacheDir); err != nil {
 		return err
 	}
-	slog.Debug("got config uri", "uri", configUri, "scheme", configUri.Scheme)
 
-	switch configUri.Scheme {
-	case "file":
-		configPath, err := config.ExpandHome(myConfig.Config.Neovim.ConfigURI[len("file://"):])
+	if myConfig.Config.Neovim.Plugins.Cache {
+		cached, err := CachePlugins(myConfig.Config, cacheDir, filepath.Join(configPath, "lazy-lock.json"))
 		if err != nil {
 			return err
 		}
-		slog.Debug("nvim config path", "p", configPath)
-
-		output, err = composeFile.Exec(serviceName, docker.ExecParams{
-			Args: []string{"sh", "-c",
-				fmt.Sprintf(
-					"mkdir -p '%s/.config' && chown -R '%s' '%s' && test -d '%s/.config/nvim' || echo -n 'nvim_not_found'",
-					remoteHome,
-					devcontainer.Spec.RemoteUser,
-					remoteHome,
-					remoteHome)},
-			User: "root",
-		})
-		if err != nil {
-			return fmt.Errorf("error configuring user home: %w", err)
+		if err := shipPlugins(remote, remoteHome, devcontainer.Spec.RemoteUser, cached); err != nil {
+			return err
 		}
+	}
+
+	libc, err := remoteLibc(remote)
+	if err != nil {
+		return err
+	}
 
-		if output == "nvim_not_found" {
-			err = composeFile.CpToService(
-				serviceName, configPath, filepath.Join(remoteHome, ".config", "nvim"),
-				docker.CpToServiceOptions{FollowLink: true})
+	// with builds on the host the target only installs what's shipped to it
+	buildOnHost := myConfig.Config.Neovim.Build.OnHost && !options.BuildMode.Rollback
+	remoteBuildMode := options.BuildMode
+	if buildOnHost {
+		remoteBuildMode = BuildMode{Prebuilt: true}
+	}
+
+	var neovimArtifacts []neovimArtifact
+	for _, tag := range myConfig.Config.NeovimTags() {
+		if buildOnHost {
+			err := BuildNeovimOnHost(myConfig.Config, cacheDir, tag, arch, libc, options.BuildMode)
 			if err != nil {
-				return err
+				return fmt.Errorf("error building neovim %s on host: %w", tag, err)
 			}
-		} else {
-			slog.Warn("remote nvim config dir exists, not overwritting...")
 		}
-	default:
-		return fmt.Errorf("invalid nvim config uri, skipping")
+
+		artifact, err := shipNeovimArtifact(myConfig.Config, remote, cacheDir, tag, arch, libc, remoteBuildMode)
+		if err != nil {
+			return err
+		}
+		neovimArtifacts = append(neovimArtifacts, artifact)
 	}
 
 	slog.Info("running remote setup, this might take a while...")
-	output, err = composeFile.Exec(serviceName, docker.ExecParams{
-		Args: []string{remoteBinary, "-v", "-c", remoteConfig, "remote-setup"},
+	remoteArgs := []string{remoteBinary}
+	if options.Verbose {
+		remoteArgs = append(remoteArgs, "-v")
+	}
+	remoteArgs = append(remoteArgs, "-c", remoteConfig, "remote-setup")
+	remoteArgs = append(remoteArgs, remoteBuildMode.Args()...)
+	_, err = remote.Exec(docker.ExecParams{
+		Args:   remoteArgs,
+		Stream: true,
+		User:   "root",
+	})
+	if err != nil {
+		return fmt.Errorf("remote setup failed: %w", err)
+	}
+
+	for _, artifact := range neovimArtifacts {
+		if err := fetchNeovimArtifact(remote, artifact, remoteBuildMode); err != nil {
+			slog.Warn("could not cache neovim build", "file", artifact.local, "error", err)
+		}
+	}
+
+	slog.Info("all done")
+
+	return nil
+}
+
+func remoteLibc(remote target.Target) (string, error) {
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"sh", "-c", libcScript},
+		User: "root",
+	})
+	if err != nil {
+		return "", fmt.Errorf("error detecting remote libc: %w", err)
+	}
+
+	if strings.TrimSpace(output) == LibcMusl {
+		return LibcMusl, nil
+	}
+	return LibcGlibc, nil
+}
+
+type neovimArtifact struct {
+	local  string
+	remote string
+	cached bool
+}
+
+// Copies the prebuilt neovim for the target from the cache, so the remote
+// setup doesn't need to compile it.
+func shipNeovimArtifact(
+	myConfig config.Config,
+	remote target.Target,
+	cacheDir string,
+	tag string,
+	arch config.ConfigToolArch,
+	libc string,
+	buildMode BuildMode,
+) (neovimArtifact, error) {
+	if _, err := NeovimSourceUrl(tag); err != nil {
+		return neovimArtifact{}, err
+	}
+
+	buildArgs, err := BuildArgs(myConfig.Neovim.Build)
+	if err != nil {
+		return neovimArtifact{}, err
+	}
+
+	name := NeovimArtifactName(tag, arch, libc, buildFlavor(buildArgs))
+	artifact := neovimArtifact{
+		local:  filepath.Join(cacheDir, "neovim", name),
+		remote: filepath.Join(NeovimDir(myConfig.Remote.Workdir, tag), name),
+	}
+
+	if _, err := os.Stat(artifact.local); err != nil {
+		slog.Debug("no prebuilt neovim in cache", "file", artifact.local)
+		return artifact, nil
+	}
+	artifact.cached = true
+
+	if buildMode.Rebuild || buildMode.Rollback {
+		return artifact, nil
+	}
+
+	shippedDir := filepath.Join(myConfig.Remote.Workdir, "neovim", neovimShippedDir)
+	_, err = remote.Exec(docker.ExecParams{
+		Args: []string{"mkdir", "-p", shippedDir},
 		User: "root",
 	})
 	if err != nil {
+		return artifact, err
+	}
+
+	slog.Info("copying prebuilt neovim", "file", name)
+	for _, file := range []string{artifact.local, artifact.local + ".commit"} {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		if err := remote.CopyTo(file, filepath.Join(shippedDir, filepath.Base(file)), target.CopyOptions{}); err != nil {
+			return artifact, err
+		}
+	}
+
+	return artifact, nil
+}
+
+// Copies the neovim built by the remote setup to the cache, for the next
+// targets with the same architecture and libc. With an update or rebuild the
+// cached build is replaced if the remote one is different, the previous one
+// is kept as `.prev`.
+func fetchNeovimArtifact(remote target.Target, artifact neovimArtifact, buildMode BuildMode) error {
+	if buildMode.Rollback || (artifact.cached && !buildMode.Update && !buildMode.Rebuild) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(artifact.local), 0o755); err != nil {
 		return err
 	}
-	slog.Debug("out", "o", output)
 
-	slog.Info("all done")
+	newFile := artifact.local + ".new"
+	defer os.Remove(newFile)
+	defer os.Remove(newFile + ".commit")
+
+	// builds without a recorded commit can't be compared
+	if err := remote.CopyFrom(artifact.remote+".commit", newFile+".commit"); err != nil {
+		slog.Debug("no commit for remote neovim build", "error", err)
+	}
+	commit := readCommit(newFile + ".commit")
+	if artifact.cached && !buildMode.Rebuild && commitsMatch(commit, readCommit(artifact.local+".commit")) {
+		return nil
+	}
+
+	if err := remote.CopyFrom(artifact.remote, newFile); err != nil {
+		return err
+	}
+	if err := replaceArtifact(artifact.local, newFile); err != nil {
+		return err
+	}
+	slog.Info("cached neovim build", "file", artifact.local, "commit", commit)
 
 	return nil
 }
 
-func RemoteSetup(myConfig config.ConfigViper) error {
+func writeRunscript(runscript string, neovimSrc string) error {
+	nvimRun := fmt.Sprintf(`#!/bin/sh
+VIM="%s" "%s" "$@"`, neovimSrc, filepath.Join(neovimSrc, "zig-out", "bin", "nvim"))
+	fp, err := os.Create(runscript)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = fp.WriteString(nvimRun)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(runscript, 0o755)
+}
+
+func RemoteSetup(myConfig config.ConfigViper, buildMode BuildMode) error {
 	cmd := exec.Command("uname", "-m")
 	output, err := cmd.Output()
 	if err != nil {
@@ -308,87 +484,37 @@ func RemoteSetup(myConfig config.ConfigViper) error {
 
 	toolsDir := filepath.Join(myConfig.Config.Remote.Workdir, "tools", _arch)
 
-	neovimDir := filepath.Join(myConfig.Config.Remote.Workdir, "neovim")
-	if err := os.MkdirAll(neovimDir, 0o755); err != nil {
-		return err
-	}
-
-	neovimSrc, err := DownloadAndExtractNeovim(neovimDir, "nightly", false)
-	if err != nil {
-		return err
-	}
-
 	zigBin := filepath.Join(toolsDir, "zig", config.ZigTool.Archives[arch].Links[config.DefaultZigLink])
 
-	err = CompileNeovim(zigBin, neovimSrc)
-	if err != nil {
-		return err
-	}
+	var neovimSrcs []string
+	for _, tag := range myConfig.Config.NeovimTags() {
+		neovimSrc, err := InstallNeovim(myConfig.Config, tag, arch, zigBin, buildMode)
+		if err != nil {
+			return fmt.Errorf("error installing neovim %s: %w", tag, err)
+		}
+		neovimSrcs = append(neovimSrcs, neovimSrc)
 
-	nvimRun := fmt.Sprintf(`#!/bin/sh
-VIM="%s" "%s" "$@"`, neovimSrc, filepath.Join(neovimSrc, "zig-out", "bin", "nvim"))
-	fp, err := os.Create(myConfig.Config.Neovim.Runscript)
-	if err != nil {
-		return err
+		if err := writeRunscript(myConfig.Config.NeovimRunscript(tag), neovimSrc); err != nil {
+			return err
+		}
 	}
-	defer fp.Close()
-	_, err = fp.WriteString(nvimRun)
-	if err != nil {
+
+	if err := CompileTreesitterParsers(myConfig.Config, zigBin, arch, Libc(arch), neovimSrcs); err != nil {
 		return err
 	}
-	if err := os.Chmod(myConfig.Config.Neovim.Runscript, 0o755); err != nil {
+
+	if err := linkRunscript(myConfig.Config, runscriptTag(myConfig.Config)); err != nil {
 		return err
 	}
 
 	if myConfig.Config.Remote.ExtraBashRc != "" {
-		output, err := exec.Command("getent", "passwd", myConfig.Config.Remote.User).Output()
-		if err != nil {
-			return err
-		}
-		userHome := strings.Split(string(output), ":")[5]
-		if userHome == "/" || userHome == "" {
-			return fmt.Errorf("error getting remote user home")
-		}
-		extraRc := filepath.Join(userHome, ".bashrc_extra")
-
-		file, err := os.Create(extraRc)
-		if err != nil {
-			return fmt.Errorf("error opening file: %w", err)
-		}
-
-		if _, err := io.Copy(file, bytes.NewReader([]byte(myConfig.Config.Remote.ExtraBashRc))); err != nil {
-			file.Close()
-			return fmt.Errorf("unexpected error: %s", err)
-		}
-		file.Close()
-
-		rcFile := filepath.Join(userHome, ".bashrc")
-
-		file, err = os.OpenFile(rcFile, os.O_CREATE|os.O_RDWR, 0o600)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		lineToAdd := ". " + extraRc
-		hasLine, err := utils.FileContainsLine(file, lineToAdd)
-		if err != nil {
+		if err := WriteExtraRc(myConfig.Config, arch); err != nil {
 			return err
 		}
-		if !hasLine {
-			_, err = file.Seek(0, 2)
-			if err != nil {
-				return err
-			}
-			_, err = file.WriteString("\n" + lineToAdd + "\n")
-			if err != nil {
-				return err
-			}
-		}
-		file.Close()
+	}
 
-		err = exec.Command("chown", "-R", myConfig.Config.Remote.User, userHome).Run()
-		if err != nil {
+	if myConfig.Config.Neovim.Plugins.Sync {
+		if err := SyncPlugins(myConfig.Config); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,333 @@
+package setup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+type fakeTransport map[string][]byte
+
+func (ft fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	content, ok := ft[req.URL.String()]
+	if !ok {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(bytes.NewReader(content)),
+		Request:    req,
+	}, nil
+}
+
+func useFakeTransport(t *testing.T, files fakeTransport) {
+	t.Helper()
+	previous := http.DefaultTransport
+	http.DefaultTransport = files
+	t.Cleanup(func() { http.DefaultTransport = previous })
+}
+
+func writeTestConfig(t *testing.T, dir string, content string) config.ConfigViper {
+	t.Helper()
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	myConfig, err := config.LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return myConfig
+}
+
+func fakeSelfBinary(t *testing.T, myConfig config.Config, arch config.ConfigToolArch) fakeTransport {
+	t.Helper()
+	var gzipped bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzipped)
+	if _, err := gzWriter.Write([]byte("#!/bin/sh\n")); err != nil {
+		t.Fatal(err)
+	}
+	gzWriter.Close()
+
+	archive := config.WithNvimMindevcTool(myConfig).Tools["nvim-mindevc"].Archives[arch]
+	checksums := fmt.Sprintf("%x  %s\n", sha256.Sum256(gzipped.Bytes()), filepath.Base(archive.Url))
+
+	return fakeTransport{
+		archive.Url:                     gzipped.Bytes(),
+		archive.Hash:                    []byte(checksums),
+		"https://curl.se/ca/cacert.pem": []byte("certs"),
+	}
+}
+
+func TestSetup_LocalDir(t *testing.T) {
+	tempDir := t.TempDir()
+
+	nvimConfigDir := filepath.Join(tempDir, "nvim")
+	if err := os.MkdirAll(nvimConfigDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nvimConfigDir, "init.lua"), []byte("-- init"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	myConfig := writeTestConfig(t, tempDir, fmt.Sprintf(`
+cache_dir: %s
+install_tools: []
+neovim:
+  config_uri: file://%s
+`, filepath.Join(tempDir, "cache"), nvimConfigDir))
+
+	useFakeTransport(t, fakeSelfBinary(t, myConfig.Config, config.ToolArch_x86_64))
+
+	var devcontainer config.Devcontainer
+	devcontainer.Spec.RemoteUser = "user"
+	// only sessions run it, not the setup
+	devcontainer.Spec.PostAttachCommand = config.LifecycleCommand{"": {"/bin/sh", "-c", "echo attached"}}
+
+	remote := &target.LocalDir{
+		Root:     filepath.Join(tempDir, "remote"),
+		ArchName: config.ToolArch_x86_64,
+		ExecFunc: func(execParams docker.ExecParams) (string, error) {
+			if len(execParams.Args) > 2 && strings.Contains(execParams.Args[2], "nvim_not_found") {
+				return "nvim_not_found", nil
+			}
+			return "", nil
+		},
+	}
+
+	if err := Setup(myConfig, devcontainer, remote, SetupOptions{SkipSelfBinary: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, remoteFile := range []string{
+		"/opt/nvim-mindevc/config.yaml",
+		"/opt/nvim-mindevc/cacert.pem",
+		"/opt/nvim-mindevc/tools/_download/nvim-mindevc",
+		"/home/user/.config/nvim/init.lua",
+	} {
+		if _, err := os.Stat(remote.Path(remoteFile)); err != nil {
+			t.Errorf("expected remote file %s: %s", remoteFile, err)
+		}
+	}
+
+	lastExec := remote.Executed[len(remote.Executed)-1]
+	if !slices.Contains(lastExec.Args, "remote-setup") {
+		t.Fatalf("expected remote-setup to run last, got %v", lastExec.Args)
+	}
+	if slices.Contains(lastExec.Args, "-v") {
+		t.Fatalf("expected remote-setup without verbose output, got %v", lastExec.Args)
+	}
+}
+
+type startableLocalDir struct {
+	*target.LocalDir
+	running bool
+	started bool
+	stopped bool
+}
+
+func (local *startableLocalDir) Start(timeout time.Duration) (bool, error) {
+	if local.running {
+		return false, nil
+	}
+	local.running = true
+	local.started = true
+	return true, nil
+}
+
+func (local *startableLocalDir) Stop() error {
+	local.running = false
+	local.stopped = true
+	return nil
+}
+
+func TestSetup_Up(t *testing.T) {
+	testTable := []struct {
+		name           string
+		running        bool
+		shutdownAction string
+		wantStarted    bool
+		wantStopped    bool
+	}{
+		{name: "not running", wantStarted: true},
+		{name: "not running stop compose", shutdownAction: "stopCompose", wantStarted: true},
+		{name: "running stop compose", running: true, shutdownAction: "stopCompose"},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			myConfig := writeTestConfig(t, tempDir, fmt.Sprintf(`
+cache_dir: %s
+install_tools: []
+neovim:
+  config_uri: file://%s
+container:
+  up: true
+`, filepath.Join(tempDir, "cache"), tempDir))
+			useFakeTransport(t, fakeSelfBinary(t, myConfig.Config, config.ToolArch_x86_64))
+
+			var devcontainer config.Devcontainer
+			devcontainer.Spec.RemoteUser = "user"
+			devcontainer.Spec.ShutdownAction = tv.shutdownAction
+
+			remote := &startableLocalDir{
+				LocalDir: &target.LocalDir{Root: filepath.Join(tempDir, "remote"), ArchName: config.ToolArch_x86_64},
+				running:  tv.running,
+			}
+
+			if err := Setup(myConfig, devcontainer, remote, SetupOptions{SkipSelfBinary: true}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if remote.started != tv.wantStarted {
+				t.Errorf("expected started to be %v", tv.wantStarted)
+			}
+			if remote.stopped != tv.wantStopped {
+				t.Errorf("expected stopped to be %v", tv.wantStopped)
+			}
+		})
+	}
+}
+
+func TestSetup_UpNotSupported(t *testing.T) {
+	tempDir := t.TempDir()
+	myConfig := writeTestConfig(t, tempDir, "container:\n  up: true\n")
+
+	var devcontainer config.Devcontainer
+	devcontainer.Spec.RemoteUser = "user"
+
+	remote := &target.LocalDir{Root: tempDir, ArchName: config.ToolArch_x86_64}
+	if err := Setup(myConfig, devcontainer, remote, SetupOptions{SkipSelfBinary: true}); err == nil {
+		t.Fatal("expected error for target that can't be started")
+	}
+}
+
+func TestSetup_RequiresRemoteUser(t *testing.T) {
+	tempDir := t.TempDir()
+	myConfig := writeTestConfig(t, tempDir, "install_tools: []\n")
+
+	remote := &target.LocalDir{Root: tempDir, ArchName: config.ToolArch_x86_64}
+	if err := Setup(myConfig, config.Devcontainer{}, remote, SetupOptions{SkipSelfBinary: true}); err == nil {
+		t.Fatal("expected error for empty remoteUser")
+	}
+	if len(remote.Executed) > 0 {
+		t.Fatalf("expected nothing to be executed, got %v", remote.Executed)
+	}
+}
+
+func TestSetup_NeovimArtifact(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	myConfig := writeTestConfig(t, tempDir, fmt.Sprintf(`
+cache_dir: %s
+install_tools: []
+neovim:
+  config_uri: file://%s
+`, cacheDir, tempDir))
+	useFakeTransport(t, fakeSelfBinary(t, myConfig.Config, config.ToolArch_x86_64))
+
+	var devcontainer config.Devcontainer
+	devcontainer.Spec.RemoteUser = "user"
+
+	artifactName := NeovimArtifactName("nightly", config.ToolArch_x86_64, LibcMusl, "")
+	neovimDir := NeovimDir(myConfig.Config.Remote.Workdir, "nightly")
+	remoteArtifact := filepath.Join(neovimDir, artifactName)
+	shippedArtifact := filepath.Join(myConfig.Config.Remote.Workdir, "neovim", neovimShippedDir, artifactName)
+	cachedArtifact := filepath.Join(cacheDir, "neovim", artifactName)
+
+	// emulates the remote setup, which uses the shipped build or builds one
+	newRemote := func(name string) *target.LocalDir {
+		remote := &target.LocalDir{Root: filepath.Join(tempDir, name), ArchName: config.ToolArch_x86_64}
+		remote.ExecFunc = func(execParams docker.ExecParams) (string, error) {
+			if slices.Contains(execParams.Args, libcScript) {
+				return "musl\n", nil
+			}
+			if !slices.Contains(execParams.Args, "remote-setup") {
+				return "", nil
+			}
+
+			if err := os.MkdirAll(remote.Path(neovimDir), 0o755); err != nil {
+				return "", err
+			}
+			if slices.Contains(execParams.Args, "--update") {
+				if err := os.WriteFile(remote.Path(remoteArtifact+".commit"), []byte("bbb\n"), 0o644); err != nil {
+					return "", err
+				}
+				return "", os.WriteFile(remote.Path(remoteArtifact), []byte("updated"), 0o644)
+			}
+			if _, err := os.Stat(remote.Path(shippedArtifact)); err == nil {
+				return "", os.Rename(remote.Path(shippedArtifact), remote.Path(remoteArtifact))
+			}
+			if err := os.WriteFile(remote.Path(remoteArtifact+".commit"), []byte("aaa\n"), 0o644); err != nil {
+				return "", err
+			}
+			return "", os.WriteFile(remote.Path(remoteArtifact), []byte("built"), 0o644)
+		}
+		return remote
+	}
+
+	readFile := func(file string) string {
+		t.Helper()
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return string(content)
+	}
+
+	first := newRemote("first")
+	if err := Setup(myConfig, devcontainer, first, SetupOptions{SkipSelfBinary: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := readFile(cachedArtifact); got != "built" {
+		t.Fatalf("expected neovim build to be cached, got %q", got)
+	}
+	if got := readCommit(cachedArtifact + ".commit"); got != "aaa" {
+		t.Fatalf("expected build commit to be cached, got %q", got)
+	}
+
+	second := newRemote("second")
+	if err := Setup(myConfig, devcontainer, second, SetupOptions{SkipSelfBinary: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := readFile(second.Path(remoteArtifact)); got != "built" {
+		t.Fatalf("expected cached neovim build to be shipped, got %q", got)
+	}
+
+	err := Setup(myConfig, devcontainer, second, SetupOptions{SkipSelfBinary: true, BuildMode: BuildMode{Update: true}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := readFile(cachedArtifact); got != "updated" {
+		t.Fatalf("expected updated build to be cached, got %q", got)
+	}
+	if got := readFile(cachedArtifact + ".prev"); got != "built" {
+		t.Fatalf("expected previous build to be kept, got %q", got)
+	}
+	if got := readCommit(cachedArtifact + ".prev.commit"); got != "aaa" {
+		t.Fatalf("expected previous build commit to be kept, got %q", got)
+	}
+}
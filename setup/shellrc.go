@@ -0,0 +1,134 @@
+package setup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/utils"
+)
+
+type shellRc struct {
+	// File with the extra rc, relative to the home
+	Extra string
+	// File that sources Extra, empty if the shell reads it by itself
+	Hook string
+}
+
+// Where the extra rc goes for a login shell. Shells other than bash, zsh and
+// fish get it from `.profile`.
+func shellRcFiles(shell string) shellRc {
+	switch filepath.Base(shell) {
+	case "bash":
+		return shellRc{Extra: ".bashrc_extra", Hook: ".bashrc"}
+	case "zsh":
+		return shellRc{Extra: ".zshrc_extra", Hook: ".zshrc"}
+	case "fish":
+		return shellRc{Extra: filepath.Join(".config", "fish", "conf.d", "nvim-mindevc.fish")}
+	}
+	return shellRc{Extra: ".profile_extra", Hook: ".profile"}
+}
+
+// Variables available to the extra_bash_rc template.
+type ExtraRcVars struct {
+	Workdir string
+	// Folder with the installed tools and the runscript
+	BinDir string
+	Arch   string
+	User   string
+	Home   string
+	// Name of the login shell, like bash or fish
+	Shell string
+}
+
+func renderExtraRc(text string, vars ExtraRcVars) (string, error) {
+	tmpl, err := template.New("extra_bash_rc").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing extra_bash_rc: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("error rendering extra_bash_rc: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Writes the extra rc file for the login shell of user and makes the shell
+// load it. Created files and folders are owned by user.
+func writeExtraRc(text string, user systemUser, vars ExtraRcVars) error {
+	rc := shellRcFiles(user.Shell)
+	vars.User = user.Name
+	vars.Home = user.Home
+	vars.Shell = filepath.Base(user.Shell)
+
+	content, err := renderExtraRc(text, vars)
+	if err != nil {
+		return err
+	}
+
+	extraRc := filepath.Join(user.Home, rc.Extra)
+	if err := os.MkdirAll(filepath.Dir(extraRc), 0o755); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(extraRc); dir != user.Home && dir != "/"; dir = filepath.Dir(dir) {
+		if err := os.Chown(dir, int(user.Uid), int(user.Gid)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(extraRc, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", extraRc, err)
+	}
+	if err := os.Chown(extraRc, int(user.Uid), int(user.Gid)); err != nil {
+		return err
+	}
+
+	if rc.Hook == "" {
+		return nil
+	}
+
+	rcFile := filepath.Join(user.Home, rc.Hook)
+	file, err := os.OpenFile(rcFile, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lineToAdd := ". " + extraRc
+	hasLine, err := utils.FileContainsLine(file, lineToAdd)
+	if err != nil {
+		return err
+	}
+	if !hasLine {
+		if _, err := file.Seek(0, 2); err != nil {
+			return err
+		}
+		if _, err := file.WriteString("\n" + lineToAdd + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return os.Chown(rcFile, int(user.Uid), int(user.Gid))
+}
+
+// Writes Remote.ExtraBashRc, rendered as a Go template with ExtraRcVars, for
+// the login shell of the remote user.
+func WriteExtraRc(myConfig config.Config, arch config.ConfigToolArch) error {
+	user, err := lookupUser(myConfig.Remote.User)
+	if err != nil {
+		return err
+	}
+	if user.Home == "/" || user.Home == "" {
+		return fmt.Errorf("error getting remote user home")
+	}
+
+	return writeExtraRc(myConfig.Remote.ExtraBashRc, user, ExtraRcVars{
+		Workdir: myConfig.Remote.Workdir,
+		BinDir:  filepath.Join(myConfig.Remote.Workdir, "bin"),
+		Arch:    string(arch),
+	})
+}
@@ -0,0 +1,108 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellRcFiles(t *testing.T) {
+	testTable := []struct {
+		shell    string
+		expected shellRc
+	}{
+		{shell: "/bin/bash", expected: shellRc{Extra: ".bashrc_extra", Hook: ".bashrc"}},
+		{shell: "/usr/bin/zsh", expected: shellRc{Extra: ".zshrc_extra", Hook: ".zshrc"}},
+		{shell: "/usr/bin/fish", expected: shellRc{Extra: ".config/fish/conf.d/nvim-mindevc.fish"}},
+		{shell: "/bin/ash", expected: shellRc{Extra: ".profile_extra", Hook: ".profile"}},
+		{shell: "", expected: shellRc{Extra: ".profile_extra", Hook: ".profile"}},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.shell, func(t *testing.T) {
+			if got := shellRcFiles(tv.shell); got != tv.expected {
+				t.Fatalf("expected %v, got %v", tv.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteExtraRc(t *testing.T) {
+	text := `{{if eq .Shell "fish"}}fish_add_path {{.BinDir}}{{else}}export PATH="{{.BinDir}}:$PATH"{{end}}
+# {{.User}} {{.Arch}}
+`
+	vars := ExtraRcVars{Workdir: "/opt/nvim-mindevc", BinDir: "/opt/nvim-mindevc/bin", Arch: "x86_64"}
+
+	testTable := []struct {
+		name     string
+		shell    string
+		extra    string
+		hook     string
+		expected string
+	}{
+		{
+			name:     "bash",
+			shell:    "/bin/bash",
+			extra:    ".bashrc_extra",
+			hook:     ".bashrc",
+			expected: "export PATH=\"/opt/nvim-mindevc/bin:$PATH\"\n# vscode x86_64\n",
+		},
+		{
+			name:     "ash",
+			shell:    "/bin/ash",
+			extra:    ".profile_extra",
+			hook:     ".profile",
+			expected: "export PATH=\"/opt/nvim-mindevc/bin:$PATH\"\n# vscode x86_64\n",
+		},
+		{
+			name:     "fish",
+			shell:    "/usr/bin/fish",
+			extra:    ".config/fish/conf.d/nvim-mindevc.fish",
+			expected: "fish_add_path /opt/nvim-mindevc/bin\n# vscode x86_64\n",
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			home := t.TempDir()
+			user := systemUser{
+				Name:  "vscode",
+				Uid:   uint32(os.Getuid()),
+				Gid:   uint32(os.Getgid()),
+				Home:  home,
+				Shell: tv.shell,
+			}
+
+			// running twice doesn't add the hook again
+			for range 2 {
+				if err := writeExtraRc(text, user, vars); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			content, err := os.ReadFile(filepath.Join(home, tv.extra))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tv.expected {
+				t.Fatalf("expected %q, got %q", tv.expected, content)
+			}
+
+			if tv.hook == "" {
+				return
+			}
+			hook, err := os.ReadFile(filepath.Join(home, tv.hook))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count := strings.Count(string(hook), ". "+filepath.Join(home, tv.extra)); count != 1 {
+				t.Fatalf("expected the hook once, got %d in %q", count, hook)
+			}
+		})
+	}
+
+	if err := writeExtraRc("{{.Nope}}", systemUser{Home: t.TempDir(), Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}, vars); err == nil {
+		t.Fatalf("expected error for unknown variable")
+	}
+}
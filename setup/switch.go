@@ -0,0 +1,96 @@
+package setup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+// The file that records the tag chosen with `switch`, so the setup doesn't
+// point the runscript back to neovim.tag.
+func switchedTagFile(workdir string) string {
+	return filepath.Join(workdir, "neovim", "switched")
+}
+
+// The tag Neovim.Runscript should point to: the switched one while it's
+// installed, otherwise Neovim.Tag.
+func runscriptTag(myConfig config.Config) string {
+	content, err := os.ReadFile(switchedTagFile(myConfig.Remote.Workdir))
+	if err != nil {
+		return myConfig.Neovim.Tag
+	}
+
+	tag := strings.TrimSpace(string(content))
+	if _, err := NeovimSourceUrl(tag); err != nil {
+		return myConfig.Neovim.Tag
+	}
+	if _, err := os.Stat(myConfig.NeovimRunscript(tag)); err != nil {
+		return myConfig.Neovim.Tag
+	}
+
+	if tag != myConfig.Neovim.Tag {
+		slog.Info("keeping switched neovim, switch to neovim.tag to undo", "tag", tag)
+	}
+	return tag
+}
+
+// Points Neovim.Runscript to the runscript of tag.
+func linkRunscript(myConfig config.Config, tag string) error {
+	tagRunscript := myConfig.NeovimRunscript(tag)
+	if tagRunscript == myConfig.Neovim.Runscript {
+		return nil
+	}
+
+	if _, err := os.Lstat(myConfig.Neovim.Runscript); err == nil {
+		if err := os.Remove(myConfig.Neovim.Runscript); err != nil {
+			return err
+		}
+	}
+
+	return os.Symlink(filepath.Base(tagRunscript), myConfig.Neovim.Runscript)
+}
+
+// Makes the neovim of tag the one `neovim.runscript` runs in the target. It
+// must have been installed by the setup, as `neovim.tag` or in
+// `neovim.versions`. The choice is kept by later setups until switching back
+// to `neovim.tag`.
+func SwitchNeovim(myConfig config.Config, remote target.Target, tag string) error {
+	if _, err := NeovimSourceUrl(tag); err != nil {
+		return err
+	}
+
+	tagRunscript := myConfig.NeovimRunscript(tag)
+	link := fmt.Sprintf("ln -sf '%s' '%s'", filepath.Base(tagRunscript), myConfig.Neovim.Runscript)
+	if tagRunscript == myConfig.Neovim.Runscript {
+		link = "true"
+	}
+
+	switched := switchedTagFile(myConfig.Remote.Workdir)
+	if tag == myConfig.Neovim.Tag {
+		link += fmt.Sprintf(" && rm -f '%s'", switched)
+	} else {
+		link += fmt.Sprintf(" && echo '%s' > '%s'", tag, switched)
+	}
+
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"sh", "-c", fmt.Sprintf(
+			`test -x '%s' || { echo -n not_installed; exit 0; }; %s`, tagRunscript, link)},
+		User: "root",
+	})
+	if err != nil {
+		return fmt.Errorf("error switching neovim: %w", err)
+	}
+	if output == "not_installed" {
+		return fmt.Errorf("neovim %s is not installed, add it to neovim.versions and run setup", tag)
+	}
+
+	slog.Info("switched neovim", "tag", tag, "runscript", myConfig.Neovim.Runscript)
+
+	return nil
+}
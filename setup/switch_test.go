@@ -0,0 +1,120 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestLinkRunscript(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var myConfig config.Config
+	myConfig.Neovim.Runscript = filepath.Join(tempDir, "nvim")
+
+	// runscripts written before versions were supported are regular files
+	if err := os.WriteFile(myConfig.Neovim.Runscript, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"nightly", "stable"} {
+		if err := linkRunscript(myConfig, tag); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		link, err := os.Readlink(myConfig.Neovim.Runscript)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if link != "nvim-"+tag {
+			t.Fatalf("expected runscript to link to nvim-%s, got %s", tag, link)
+		}
+	}
+}
+
+func TestRunscriptTag(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var myConfig config.Config
+	myConfig.Remote.Workdir = tempDir
+	myConfig.Neovim.Tag = "nightly"
+	myConfig.Neovim.Runscript = filepath.Join(tempDir, "bin", "nvim")
+
+	if got := runscriptTag(myConfig); got != "nightly" {
+		t.Fatalf("expected nightly without switched tag, got %s", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(tempDir, "neovim"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(switchedTagFile(tempDir), []byte("stable\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := runscriptTag(myConfig); got != "nightly" {
+		t.Fatalf("expected nightly while the switched tag isn't installed, got %s", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(tempDir, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(myConfig.NeovimRunscript("stable"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := runscriptTag(myConfig); got != "stable" {
+		t.Fatalf("expected switched tag stable, got %s", got)
+	}
+}
+
+func TestSwitchNeovim(t *testing.T) {
+	var myConfig config.Config
+	myConfig.Remote.Workdir = "/opt/nvim-mindevc"
+	myConfig.Neovim.Tag = "nightly"
+	myConfig.Neovim.Runscript = "/opt/nvim-mindevc/bin/nvim"
+
+	testTable := []struct {
+		name       string
+		tag        string
+		output     string
+		wantMarker string
+		wantErr    bool
+	}{
+		{name: "installed", tag: "stable", wantMarker: "echo 'stable' > '/opt/nvim-mindevc/neovim/switched'"},
+		{name: "back to neovim.tag", tag: "nightly", wantMarker: "rm -f '/opt/nvim-mindevc/neovim/switched'"},
+		{name: "not installed", tag: "v0.9.0", output: "not_installed", wantErr: true},
+		{name: "invalid tag", tag: "../stable", wantErr: true},
+	}
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			remote := &target.LocalDir{
+				Root: t.TempDir(),
+				ExecFunc: func(execParams docker.ExecParams) (string, error) {
+					return tv.output, nil
+				},
+			}
+
+			err := SwitchNeovim(myConfig, remote, tv.tag)
+			if tv.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			script := remote.Executed[0].Args[2]
+			if !strings.Contains(script, "ln -sf 'nvim-"+tv.tag+"' '/opt/nvim-mindevc/bin/nvim'") {
+				t.Fatalf("unexpected switch script %s", script)
+			}
+			if !strings.Contains(script, tv.wantMarker) {
+				t.Fatalf("expected switch script to contain %s, got %s", tv.wantMarker, script)
+			}
+		})
+	}
+}
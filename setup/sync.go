@@ -0,0 +1,330 @@
+package setup
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+	"github.com/davidrios/nvim-mindevc/utils"
+)
+
+const (
+	// Leave an existing config in the target as it is
+	ConfigSyncSkip = "skip"
+	// Make the config in the target the same as the host one
+	ConfigSyncOverwrite = "overwrite"
+	// Copy new and changed files, keeping files that only exist in the target
+	ConfigSyncMerge = "merge"
+	// Link the config to where the host config is mounted in the target
+	ConfigSyncBindSymlink = "bind-symlink"
+)
+
+const (
+	ConfigChangeAdd    = "add"
+	ConfigChangeUpdate = "update"
+	ConfigChangeDelete = "delete"
+	ConfigChangeLink   = "link"
+)
+
+type ConfigChange struct {
+	Action string
+	// Relative to the config folder, or the link target
+	Path string
+}
+
+type ConfigSyncOptions struct {
+	Strategy string
+	// Where the host config is mounted in the target, for bind-symlink
+	Mount string
+	// Only return the changes
+	DryRun bool
+}
+
+// The sha256 of the files in a config folder by relative path, skipping
+// `.git` folders at any depth. Symlinks to files are followed.
+func hostConfigFiles(configPath string) (map[string]string, error) {
+	root, err := filepath.EvalSymlinks(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	err = filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" && filePath != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil || !info.Mode().IsRegular() {
+			slog.Debug("skipping config file", "path", filePath)
+			return nil
+		}
+
+		hash, err := utils.Sha256File(filePath)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = hash
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// The sha256 of the files in the remote config folder, like hostConfigFiles.
+// Returns "nvim_not_found" or "symlink" as the state if it's not a folder.
+func remoteConfigFiles(remote target.Target, remoteDir string) (map[string]string, string, error) {
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"sh", "-c", fmt.Sprintf(
+			`test -L '%s' && { echo -n symlink; exit 0; }; `+
+				`test -d '%s' || { echo -n nvim_not_found; exit 0; }; `+
+				`cd '%s' && find . -name .git -type d -prune -o -type f -exec sha256sum {} +`,
+			remoteDir, remoteDir, remoteDir)},
+		User: "root",
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing remote config: %w", err)
+	}
+	if output == "nvim_not_found" || output == "symlink" {
+		return nil, output, nil
+	}
+
+	files := make(map[string]string)
+	for line := range strings.SplitSeq(output, "\n") {
+		hash, filePath, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		files[strings.TrimPrefix(filePath, "./")] = hash
+	}
+
+	return files, "", nil
+}
+
+// The changes that make the remote files the same as the host ones, sorted
+// by path. Remote only files are deleted if deleteRemoved is set.
+func diffConfigFiles(hostFiles map[string]string, remoteFiles map[string]string, deleteRemoved bool) []ConfigChange {
+	var changes []ConfigChange
+	for _, filePath := range slices.Sorted(maps.Keys(hostFiles)) {
+		remoteHash, ok := remoteFiles[filePath]
+		if !ok {
+			changes = append(changes, ConfigChange{Action: ConfigChangeAdd, Path: filePath})
+		} else if remoteHash != hostFiles[filePath] {
+			changes = append(changes, ConfigChange{Action: ConfigChangeUpdate, Path: filePath})
+		}
+	}
+
+	if deleteRemoved {
+		for _, filePath := range slices.Sorted(maps.Keys(remoteFiles)) {
+			if _, ok := hostFiles[filePath]; !ok {
+				changes = append(changes, ConfigChange{Action: ConfigChangeDelete, Path: filePath})
+			}
+		}
+		slices.SortFunc(changes, func(a, b ConfigChange) int { return strings.Compare(a.Path, b.Path) })
+	}
+
+	return changes
+}
+
+// Updates the neovim config of the remote user from the host config with the
+// strategy in options, transferring only the files that changed. Returns the
+// changes, which are not applied with DryRun.
+func SyncNeovimConfig(
+	remote target.Target,
+	configPath string,
+	remoteHome string,
+	user string,
+	options ConfigSyncOptions,
+) ([]ConfigChange, error) {
+	remoteDir := filepath.Join(remoteHome, ".config", "nvim")
+
+	if options.Strategy == ConfigSyncBindSymlink {
+		return linkNeovimConfig(remote, remoteDir, user, options)
+	}
+
+	return syncFolder(remote, configPath, remoteDir, remoteHome, user, options)
+}
+
+// Updates remoteDir from localDir with the strategy in options, see
+// SyncNeovimConfig. Copied files are owned by owner, as are the missing
+// parents of remoteDir inside remoteHome.
+func syncFolder(
+	remote target.Target,
+	localDir string,
+	remoteDir string,
+	remoteHome string,
+	owner string,
+	options ConfigSyncOptions,
+) ([]ConfigChange, error) {
+	switch options.Strategy {
+	case ConfigSyncSkip, ConfigSyncOverwrite, ConfigSyncMerge:
+	default:
+		return nil, fmt.Errorf("invalid sync strategy '%s'", options.Strategy)
+	}
+
+	hostFiles, err := hostConfigFiles(localDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", localDir, err)
+	}
+
+	remoteFiles, state, err := remoteConfigFiles(remote, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == "nvim_not_found" {
+		changes := diffConfigFiles(hostFiles, nil, false)
+		if options.DryRun {
+			return changes, nil
+		}
+
+		if err := mkdirRemote(remote, filepath.Dir(remoteDir), remoteHome, owner); err != nil {
+			return nil, err
+		}
+		if err := remote.CopyTo(localDir, remoteDir, target.CopyOptions{FollowLink: true}); err != nil {
+			return nil, err
+		}
+		return changes, chownRemote(remote, owner, remoteDir, true)
+	}
+
+	if options.Strategy == ConfigSyncSkip {
+		slog.Warn("remote folder exists, not overwritting...", "path", remoteDir)
+		return nil, nil
+	}
+	if state == "symlink" {
+		return nil, fmt.Errorf("remote %s is a symlink, remove it to use %s", remoteDir, options.Strategy)
+	}
+
+	changes := diffConfigFiles(hostFiles, remoteFiles, options.Strategy == ConfigSyncOverwrite)
+	if options.DryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	var dirs, deleted []string
+	for _, change := range changes {
+		remotePath := filepath.Join(remoteDir, change.Path)
+		if change.Action == ConfigChangeDelete {
+			deleted = append(deleted, remotePath)
+		} else if !slices.Contains(dirs, filepath.Dir(remotePath)) {
+			dirs = append(dirs, filepath.Dir(remotePath))
+		}
+	}
+
+	if len(dirs) > 0 {
+		_, err := remote.Exec(docker.ExecParams{Args: append([]string{"mkdir", "-p", "--"}, dirs...), User: "root"})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(deleted) > 0 {
+		_, err := remote.Exec(docker.ExecParams{Args: append([]string{"rm", "-f", "--"}, deleted...), User: "root"})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(localDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Action == ConfigChangeDelete {
+			continue
+		}
+		err := remote.CopyTo(
+			filepath.Join(root, filepath.FromSlash(change.Path)), filepath.Join(remoteDir, change.Path),
+			target.CopyOptions{FollowLink: true})
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("synced file", "action", change.Action, "path", filepath.Join(remoteDir, change.Path))
+	}
+
+	return changes, chownRemote(remote, owner, remoteDir, true)
+}
+
+func linkNeovimConfig(remote target.Target, remoteDir string, user string, options ConfigSyncOptions) ([]ConfigChange, error) {
+	if options.Mount == "" {
+		return nil, fmt.Errorf("neovim.config_mount must be set to use %s", ConfigSyncBindSymlink)
+	}
+
+	changes := []ConfigChange{{Action: ConfigChangeLink, Path: options.Mount}}
+	if options.DryRun {
+		return changes, nil
+	}
+
+	output, err := remote.Exec(docker.ExecParams{
+		Args: []string{"sh", "-c", fmt.Sprintf(
+			`test -d '%s' || { echo -n no_mount; exit 0; }; `+
+				`test -e '%s' && ! test -L '%s' && { echo -n not_link; exit 0; }; `+
+				`mkdir -p '%s' && ln -sfn '%s' '%s' && chown -h '%s' '%s'`,
+			options.Mount,
+			remoteDir, remoteDir,
+			filepath.Dir(remoteDir), options.Mount, remoteDir, user, remoteDir)},
+		User: "root",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error linking remote config: %w", err)
+	}
+
+	switch output {
+	case "no_mount":
+		return nil, fmt.Errorf("%s is not mounted in the devcontainer, add it to the devcontainer mounts", options.Mount)
+	case "not_link":
+		return nil, fmt.Errorf("remote nvim config exists, remove %s to use %s", remoteDir, ConfigSyncBindSymlink)
+	}
+
+	return changes, nil
+}
+
+// Creates dir and its missing parents as root. The ones created inside
+// remoteHome are given to owner, so the user can still write to their home.
+func mkdirRemote(remote target.Target, dir string, remoteHome string, owner string) error {
+	relPath, err := filepath.Rel(remoteHome, dir)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		_, err := remote.Exec(docker.ExecParams{Args: []string{"mkdir", "-p", dir}, User: "root"})
+		return err
+	}
+
+	args := []string{"sh", "-c",
+		`owner=$1; shift; for d; do test -d "$d" || { mkdir -p "$d" && chown "$owner" "$d"; } || exit 1; done`,
+		"sh", owner}
+	parent := remoteHome
+	for part := range strings.SplitSeq(relPath, string(filepath.Separator)) {
+		parent = filepath.Join(parent, part)
+		args = append(args, parent)
+	}
+
+	_, err = remote.Exec(docker.ExecParams{Args: args, User: "root"})
+	return err
+}
+
+func chownRemote(remote target.Target, owner string, remotePath string, recursive bool) error {
+	args := []string{"chown", owner, remotePath}
+	if recursive {
+		args = []string{"chown", "-R", owner, remotePath}
+	}
+	_, err := remote.Exec(docker.ExecParams{Args: args, User: "root"})
+	return err
+}
@@ -0,0 +1,235 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/docker"
+	"github.com/davidrios/nvim-mindevc/target"
+)
+
+func TestDiffConfigFiles(t *testing.T) {
+	hostFiles := map[string]string{"init.lua": "a", "lua/plugins.lua": "b", "lua/new.lua": "c"}
+	remoteFiles := map[string]string{"init.lua": "a", "lua/plugins.lua": "old", "lua/removed.lua": "d"}
+
+	testTable := []struct {
+		name          string
+		deleteRemoved bool
+		expected      []ConfigChange
+	}{
+		{
+			name: "merge",
+			expected: []ConfigChange{
+				{Action: ConfigChangeAdd, Path: "lua/new.lua"},
+				{Action: ConfigChangeUpdate, Path: "lua/plugins.lua"},
+			},
+		},
+		{
+			name:          "overwrite",
+			deleteRemoved: true,
+			expected: []ConfigChange{
+				{Action: ConfigChangeAdd, Path: "lua/new.lua"},
+				{Action: ConfigChangeUpdate, Path: "lua/plugins.lua"},
+				{Action: ConfigChangeDelete, Path: "lua/removed.lua"},
+			},
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			changes := diffConfigFiles(hostFiles, remoteFiles, tv.deleteRemoved)
+			if !slices.Equal(changes, tv.expected) {
+				t.Fatalf("expected %v, got %v", tv.expected, changes)
+			}
+		})
+	}
+}
+
+func TestSyncNeovimConfig(t *testing.T) {
+	dir := t.TempDir()
+	configDir := filepath.Join(dir, "nvim")
+	for name, content := range map[string]string{
+		"init.lua":        "-- init",
+		"lua/plugins.lua": "return {}",
+		".git/HEAD":       "ref: refs/heads/main",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(configDir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the remote has the same init.lua, an old plugins.lua and an extra file
+	remoteListing := fmt.Sprintf("%x  ./init.lua\n%x  ./lua/plugins.lua\n%x  ./lua/extra.lua\n",
+		sha256.Sum256([]byte("-- init")), sha256.Sum256([]byte("old")), sha256.Sum256([]byte("extra")))
+
+	testTable := []struct {
+		name        string
+		strategy    string
+		dryRun      bool
+		notFound    bool
+		wantErr     bool
+		wantChanges int
+		wantCopied  []string
+		wantDeleted bool
+	}{
+		{name: "new config", strategy: ConfigSyncSkip, notFound: true, wantChanges: 2, wantCopied: []string{"init.lua", "lua/plugins.lua"}},
+		{name: "skip", strategy: ConfigSyncSkip},
+		{name: "merge", strategy: ConfigSyncMerge, wantChanges: 1, wantCopied: []string{"lua/plugins.lua"}},
+		{name: "overwrite", strategy: ConfigSyncOverwrite, wantChanges: 2, wantCopied: []string{"lua/plugins.lua"}, wantDeleted: true},
+		{name: "dry run", strategy: ConfigSyncOverwrite, dryRun: true, wantChanges: 2},
+		{name: "bind-symlink without mount", strategy: ConfigSyncBindSymlink, wantErr: true},
+		{name: "invalid", strategy: "nope", wantErr: true},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			remote := &target.LocalDir{
+				Root: filepath.Join(t.TempDir(), "remote"),
+				ExecFunc: func(execParams docker.ExecParams) (string, error) {
+					if execParams.Args[0] == "sh" && strings.Contains(execParams.Args[2], "sha256sum") {
+						if tv.notFound {
+							return "nvim_not_found", nil
+						}
+						return remoteListing, nil
+					}
+					return "", nil
+				},
+			}
+
+			changes, err := SyncNeovimConfig(remote, configDir, "/home/user", "user", ConfigSyncOptions{
+				Strategy: tv.strategy,
+				DryRun:   tv.dryRun,
+			})
+			if tv.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(changes) != tv.wantChanges {
+				t.Fatalf("expected %d changes, got %v", tv.wantChanges, changes)
+			}
+
+			remoteDir := remote.Path("/home/user/.config/nvim")
+			for _, name := range tv.wantCopied {
+				if _, err := os.Stat(filepath.Join(remoteDir, name)); err != nil {
+					t.Errorf("expected %s to be copied: %s", name, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(remoteDir, "init.lua")); err == nil && !slices.Contains(tv.wantCopied, "init.lua") {
+				t.Errorf("unchanged init.lua copied")
+			}
+
+			deleted := slices.ContainsFunc(remote.Executed, func(execParams docker.ExecParams) bool {
+				return execParams.Args[0] == "rm" && slices.Contains(execParams.Args, "/home/user/.config/nvim/lua/extra.lua")
+			})
+			if deleted != tv.wantDeleted {
+				t.Errorf("expected deleted %v, got %v", tv.wantDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestRemoteConfigFiles_SameAsHost(t *testing.T) {
+	configDir := t.TempDir()
+	for _, name := range []string{"init.lua", ".git/HEAD", "pack/x/start/y/.git/HEAD", "pack/x/start/y/lua/y.lua"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(configDir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// runs the listing in the host, as if it was the container
+	remote := &target.LocalDir{
+		Root: t.TempDir(),
+		ExecFunc: func(execParams docker.ExecParams) (string, error) {
+			output, err := exec.Command(execParams.Args[0], execParams.Args[1:]...).Output()
+			return string(output), err
+		},
+	}
+
+	remoteFiles, state, err := remoteConfigFiles(remote, configDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if state != "" {
+		t.Fatalf("unexpected state %s", state)
+	}
+
+	hostFiles, err := hostConfigFiles(configDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !maps.Equal(remoteFiles, hostFiles) {
+		t.Fatalf("expected remote files %v to be the host ones %v", remoteFiles, hostFiles)
+	}
+	if len(hostFiles) != 2 {
+		t.Fatalf("expected .git folders to be skipped, got %v", hostFiles)
+	}
+}
+
+func TestMkdirRemote(t *testing.T) {
+	testTable := []struct {
+		name     string
+		dir      string
+		expected []string
+	}{
+		{
+			name: "inside home",
+			dir:  "/home/user/.config/fish/conf.d",
+			expected: []string{
+				"/home/user/.config", "/home/user/.config/fish", "/home/user/.config/fish/conf.d"},
+		},
+		{
+			name:     "home",
+			dir:      "/home/user",
+			expected: []string{"mkdir", "-p", "/home/user"},
+		},
+		{
+			name:     "outside home",
+			dir:      "/etc/profile.d",
+			expected: []string{"mkdir", "-p", "/etc/profile.d"},
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			remote := &target.LocalDir{Root: t.TempDir()}
+			if err := mkdirRemote(remote, tv.dir, "/home/user", "user"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(remote.Executed) != 1 || remote.Executed[0].User != "root" {
+				t.Fatalf("expected one command as root, got %v", remote.Executed)
+			}
+
+			args := remote.Executed[0].Args
+			if args[0] == "sh" {
+				// the created directories are chowned to the user
+				if args[4] != "user" {
+					t.Fatalf("expected owner user, got %v", args)
+				}
+				args = args[5:]
+			}
+			if !slices.Equal(args, tv.expected) {
+				t.Fatalf("expected %v, got %v", tv.expected, args)
+			}
+		})
+	}
+}
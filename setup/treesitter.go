@@ -0,0 +1,185 @@
+package setup
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/utils"
+)
+
+var treesitterParserNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Records the source a compiled parser was built from.
+func parserSource(parser config.ConfigTreesitterParser) string {
+	return strings.Join([]string{parser.Url, parser.Hash, parser.Location}, "\n") + "\n"
+}
+
+// The zig target the parsers are compiled for, matching the neovim builds.
+func parserTarget(arch config.ConfigToolArch, libc string) string {
+	if libc == LibcMusl {
+		return fmt.Sprintf("%s-linux-musl", arch)
+	}
+	return fmt.Sprintf("%s-linux-gnu", arch)
+}
+
+func downloadParser(downloadDir string, parser config.ConfigTreesitterParser) (string, error) {
+	if parser.Hash != "" {
+		parsedUrl, err := url.Parse(parser.Url)
+		if err != nil {
+			return "", err
+		}
+		return DownloadToolHttp(downloadDir, parser.Url, parsedUrl, parser.Hash)
+	}
+
+	archive := filepath.Join(downloadDir, fmt.Sprintf("%s-%x.tar.gz", parser.Name, sha256.Sum256([]byte(parser.Url))))
+	if _, err := os.Stat(archive); err == nil {
+		return archive, nil
+	}
+
+	if err := utils.DownloadFileHttp(parser.Url, archive+".tmp"); err != nil {
+		return "", err
+	}
+	return archive, os.Rename(archive+".tmp", archive)
+}
+
+// Compiles the grammar in srcDir to a shared library with zig. C++ scanners
+// are compiled with `zig c++`.
+func compileParser(zigBin string, srcDir string, target string, dest string) error {
+	if _, err := os.Stat(filepath.Join(srcDir, "parser.c")); err != nil {
+		return fmt.Errorf("no parser.c in %s", srcDir)
+	}
+
+	compiler := "cc"
+	sources := []string{"parser.c"}
+	if _, err := os.Stat(filepath.Join(srcDir, "scanner.c")); err == nil {
+		sources = append(sources, "scanner.c")
+	} else if _, err := os.Stat(filepath.Join(srcDir, "scanner.cc")); err == nil {
+		compiler = "c++"
+		sources = append(sources, "scanner.cc")
+	}
+
+	args := []string{compiler, "-target", target, "-shared", "-fPIC", "-O2", "-I", "."}
+	args = append(args, sources...)
+	args = append(args, "-o", dest)
+
+	cmd := exec.Command(zigBin, args...)
+	cmd.Dir = srcDir
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running zig %s: %w", compiler, err)
+	}
+
+	return nil
+}
+
+// Compiles the configured treesitter parsers with zig inside the remote
+// workdir, and copies them to the runtime parser folder of each neovim.
+// Parsers are only compiled again when their source changes.
+func CompileTreesitterParsers(
+	myConfig config.Config,
+	zigBin string,
+	arch config.ConfigToolArch,
+	libc string,
+	neovimSrcs []string,
+) error {
+	if len(myConfig.Treesitter.Parsers) == 0 {
+		return nil
+	}
+
+	treesitterDir := filepath.Join(myConfig.Remote.Workdir, "treesitter")
+	downloadDir := filepath.Join(treesitterDir, "_download")
+	parserDir := filepath.Join(treesitterDir, "parser")
+	for _, dir := range []string{downloadDir, parserDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	for _, parser := range myConfig.Treesitter.Parsers {
+		if !treesitterParserNameRe.MatchString(parser.Name) {
+			return fmt.Errorf("invalid treesitter parser name '%s'", parser.Name)
+		}
+
+		compiled := filepath.Join(parserDir, parser.Name+".so")
+		sourceFile := compiled + ".source"
+		source, _ := os.ReadFile(sourceFile)
+		if _, err := os.Stat(compiled); err != nil || string(source) != parserSource(parser) {
+			slog.Info("compiling treesitter parser", "name", parser.Name)
+			if err := buildParser(zigBin, treesitterDir, downloadDir, parser, parserTarget(arch, libc), compiled); err != nil {
+				return fmt.Errorf("error compiling treesitter parser %s: %w", parser.Name, err)
+			}
+			if err := os.WriteFile(sourceFile, []byte(parserSource(parser)), 0o644); err != nil {
+				return err
+			}
+		} else {
+			slog.Debug("treesitter parser already compiled", "name", parser.Name)
+		}
+
+		data, err := os.ReadFile(compiled)
+		if err != nil {
+			return err
+		}
+		for _, neovimSrc := range neovimSrcs {
+			runtimeParserDir := filepath.Join(neovimSrc, "runtime", "parser")
+			if err := os.MkdirAll(runtimeParserDir, 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(runtimeParserDir, parser.Name+".so"), data, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func buildParser(
+	zigBin string,
+	treesitterDir string,
+	downloadDir string,
+	parser config.ConfigTreesitterParser,
+	target string,
+	dest string,
+) error {
+	archive, err := downloadParser(downloadDir, parser)
+	if err != nil {
+		return err
+	}
+
+	fp, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	gzReader, err := gzip.NewReader(fp)
+	if err != nil {
+		return err
+	}
+
+	extractDir := filepath.Join(treesitterDir, "src", parser.Name)
+	if err := os.RemoveAll(extractDir); err != nil {
+		return err
+	}
+	if err := utils.ExtractTarStrip(gzReader, extractDir, 1); err != nil {
+		return fmt.Errorf("failed to extract tar: %w", err)
+	}
+
+	tmpFile := dest + ".tmp"
+	if err := compileParser(zigBin, filepath.Join(extractDir, parser.Location, "src"), target, tmpFile); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+
+	return os.Rename(tmpFile, dest)
+}
@@ -0,0 +1,141 @@
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davidrios/nvim-mindevc/config"
+)
+
+func parserSourceArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: "tree-sitter-test/" + name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A zig that logs its arguments and writes the `-o` file.
+func fakeZig(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	zigBin := filepath.Join(dir, "zig")
+	logFile := filepath.Join(dir, "zig.log")
+	script := `#!/bin/sh
+echo "$@" >> '` + logFile + `'
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-o" ]; then echo compiled > "$2"; fi
+	shift
+done
+`
+	if err := os.WriteFile(zigBin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return zigBin, logFile
+}
+
+func TestCompileTreesitterParsers(t *testing.T) {
+	useFakeTransport(t, fakeTransport{
+		"https://example.com/python.tar.gz": parserSourceArchive(t, map[string]string{
+			"src/parser.c":  "",
+			"src/scanner.c": "",
+		}),
+		"https://example.com/typescript.tar.gz": parserSourceArchive(t, map[string]string{
+			"tsx/src/parser.c":   "",
+			"tsx/src/scanner.cc": "",
+		}),
+		"https://example.com/broken.tar.gz": parserSourceArchive(t, map[string]string{
+			"README.md": "",
+		}),
+	})
+
+	testTable := []struct {
+		name     string
+		parser   config.ConfigTreesitterParser
+		wantArgs string
+		wantErr  bool
+	}{
+		{
+			name:     "c scanner",
+			parser:   config.ConfigTreesitterParser{Name: "python", Url: "https://example.com/python.tar.gz"},
+			wantArgs: "cc -target x86_64-linux-gnu -shared -fPIC -O2 -I . parser.c scanner.c -o ",
+		},
+		{
+			name:     "c++ scanner in location",
+			parser:   config.ConfigTreesitterParser{Name: "tsx", Url: "https://example.com/typescript.tar.gz", Location: "tsx"},
+			wantArgs: "c++ -target x86_64-linux-gnu -shared -fPIC -O2 -I . parser.c scanner.cc -o ",
+		},
+		{
+			name:    "no parser.c",
+			parser:  config.ConfigTreesitterParser{Name: "broken", Url: "https://example.com/broken.tar.gz"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			parser:  config.ConfigTreesitterParser{Name: "../python", Url: "https://example.com/python.tar.gz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			dir := t.TempDir()
+			zigBin, logFile := fakeZig(t, dir)
+			neovimSrc := filepath.Join(dir, "neovim")
+
+			var myConfig config.Config
+			myConfig.Remote.Workdir = filepath.Join(dir, "workdir")
+			myConfig.Treesitter.Parsers = []config.ConfigTreesitterParser{tv.parser}
+
+			err := CompileTreesitterParsers(myConfig, zigBin, "x86_64", LibcGlibc, []string{neovimSrc})
+			if tv.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			log, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(log), tv.wantArgs) {
+				t.Fatalf("unexpected zig args: %s", log)
+			}
+
+			if _, err := os.Stat(filepath.Join(neovimSrc, "runtime", "parser", tv.parser.Name+".so")); err != nil {
+				t.Fatalf("parser not installed: %s", err)
+			}
+
+			// not compiled again if the source didn't change
+			if err := CompileTreesitterParsers(myConfig, zigBin, "x86_64", LibcGlibc, []string{neovimSrc}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if log2, _ := os.ReadFile(logFile); !bytes.Equal(log, log2) {
+				t.Fatalf("parser compiled again")
+			}
+		})
+	}
+}
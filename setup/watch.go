@@ -0,0 +1,104 @@
+package setup
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How long the config must be quiet after a change before it's synced.
+const ConfigWatchDebounce = 300 * time.Millisecond
+
+func inGitDir(root string, filePath string) bool {
+	relPath, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Split(filepath.ToSlash(relPath), "/"), ".git")
+}
+
+// Watches the config folder and calls sync once the changes stop for
+// debounce, until stop is closed. ready, if not nil, is closed once changes
+// are being watched. Errors from sync are only logged.
+func WatchNeovimConfig(
+	configPath string,
+	debounce time.Duration,
+	stop <-chan struct{},
+	ready chan<- struct{},
+	sync func() error,
+) error {
+	root, err := filepath.EvalSymlinks(configPath)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// fsnotify doesn't watch subfolders
+	addDirs := func(dir string) error {
+		return filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				return nil
+			}
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return watcher.Add(filePath)
+		})
+	}
+	if err := addDirs(root); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	slog.Info("watching neovim config", "path", root)
+	if ready != nil {
+		close(ready)
+	}
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if inGitDir(root, event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addDirs(event.Name); err != nil {
+						slog.Warn("error watching config folder", "path", event.Name, "error", err)
+					}
+				}
+			}
+			slog.Debug("config changed", "path", event.Name, "op", event.Op)
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("config watcher error", "error", err)
+		case <-timer.C:
+			if err := sync(); err != nil {
+				slog.Warn("error syncing neovim config", "error", err)
+			}
+		}
+	}
+}
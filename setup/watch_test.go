@@ -0,0 +1,71 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchNeovimConfig(t *testing.T) {
+	configDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configDir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	synced := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- WatchNeovimConfig(configDir, 100*time.Millisecond, stop, ready, func() error {
+			synced <- struct{}{}
+			return nil
+		})
+	}()
+
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// every case writes files outside of .git last, so it causes exactly one
+	// sync. Extra ones are caught after the watcher stops.
+	testTable := []struct {
+		name  string
+		write []string
+	}{
+		{name: "burst", write: []string{"init.lua", "lazy-lock.json", "init.lua"}},
+		{name: "new folder", write: []string{"lua/plugins.lua"}},
+		{name: "file in new folder", write: []string{"lua/other.lua"}},
+		{name: "git folder", write: []string{".git/HEAD", ".git/index", "init.lua"}},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			for _, name := range tv.write {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(configDir, name)), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(configDir, name), []byte("-- "+name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case <-synced:
+			case <-time.After(10 * time.Second):
+				t.Fatal("expected a sync")
+			}
+		})
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(synced) > 0 {
+		t.Fatalf("expected one sync per change, got %d more", len(synced))
+	}
+}
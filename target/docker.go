@@ -0,0 +1,113 @@
+package target
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+)
+
+type Compose struct {
+	File        docker.ComposeFile
+	Service     string
+	RunServices []string
+}
+
+// The services to start, `runServices` from the devcontainer file plus the
+// devcontainer service. Without `runServices` it's empty, so that compose
+// starts all of them.
+func (compose *Compose) services() []string {
+	if len(compose.RunServices) == 0 {
+		return nil
+	}
+
+	services := []string{compose.Service}
+	for _, service := range compose.RunServices {
+		if !slices.Contains(services, service) {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+func (compose *Compose) Start(timeout time.Duration) (bool, error) {
+	if psItem, err := compose.File.Ps(compose.Service); err == nil && psItem.IsReady() {
+		return false, nil
+	}
+
+	services := compose.services()
+	if len(services) == 0 {
+		slog.Info("starting compose services", "services", "all")
+	} else {
+		slog.Info("starting compose services", "services", services)
+	}
+	if err := compose.File.Up(services); err != nil {
+		return false, err
+	}
+
+	if err := compose.File.WaitRunning(compose.Service, timeout); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+func (compose *Compose) Stop() error {
+	services := compose.services()
+	if len(services) == 0 {
+		slog.Info("stopping compose services", "services", "all")
+	} else {
+		slog.Info("stopping compose services", "services", services)
+	}
+	return compose.File.Stop(services)
+}
+
+func (compose *Compose) Exec(execParams docker.ExecParams) (string, error) {
+	return compose.File.Exec(compose.Service, execParams)
+}
+
+func (compose *Compose) CopyTo(src string, dest string, options CopyOptions) error {
+	return compose.File.CpToService(compose.Service, src, dest, docker.CpToServiceOptions{
+		FollowLink: options.FollowLink,
+	})
+}
+
+func (compose *Compose) CopyFrom(src string, dest string) error {
+	return compose.File.CpFromService(compose.Service, src, dest)
+}
+
+func (compose *Compose) Arch() (config.ConfigToolArch, error) {
+	return execArch(compose)
+}
+
+func (compose *Compose) Home(user string) (string, error) {
+	return execHome(compose, user)
+}
+
+type Container struct {
+	Container docker.Container
+}
+
+func (container *Container) Exec(execParams docker.ExecParams) (string, error) {
+	return container.Container.Exec(execParams)
+}
+
+func (container *Container) CopyTo(src string, dest string, options CopyOptions) error {
+	return container.Container.CpTo(src, dest, docker.CpToServiceOptions{
+		FollowLink: options.FollowLink,
+	})
+}
+
+func (container *Container) CopyFrom(src string, dest string) error {
+	return container.Container.CpFrom(src, dest)
+}
+
+func (container *Container) Arch() (config.ConfigToolArch, error) {
+	return execArch(container)
+}
+
+func (container *Container) Home(user string) (string, error) {
+	return execHome(container, user)
+}
@@ -0,0 +1,142 @@
+package target
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+)
+
+// LocalDir is a fake Target backed by a local directory that stands in for
+// the container filesystem. Commands are not executed, they are recorded in
+// Executed and answered by ExecFunc, if set.
+type LocalDir struct {
+	Root     string
+	ArchName config.ConfigToolArch
+	Homes    map[string]string
+	ExecFunc func(execParams docker.ExecParams) (string, error)
+	Executed []docker.ExecParams
+
+	mu sync.Mutex
+}
+
+func (localDir *LocalDir) Path(remotePath string) string {
+	return filepath.Join(localDir.Root, remotePath)
+}
+
+func (localDir *LocalDir) Exec(execParams docker.ExecParams) (string, error) {
+	localDir.mu.Lock()
+	localDir.Executed = append(localDir.Executed, execParams)
+	localDir.mu.Unlock()
+
+	if localDir.ExecFunc == nil {
+		return "", nil
+	}
+	return localDir.ExecFunc(execParams)
+}
+
+func (localDir *LocalDir) CopyTo(src string, dest string, options CopyOptions) error {
+	return copyPath(src, localDir.Path(dest), options.FollowLink)
+}
+
+func (localDir *LocalDir) CopyFrom(src string, dest string) error {
+	return copyPath(localDir.Path(src), dest, false)
+}
+
+// Copies src to dest with docker cp semantics: if dest is an existing
+// directory src is copied inside it.
+func copyPath(src string, dest string, followLink bool) error {
+	stat := os.Lstat
+	if followLink {
+		stat = os.Stat
+	}
+
+	info, err := stat(src)
+	if err != nil {
+		return err
+	}
+
+	target := dest
+	if targetInfo, err := os.Stat(target); err == nil && targetInfo.IsDir() {
+		target = filepath.Join(target, filepath.Base(src))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFile(src, target, info)
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(target, relPath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return os.MkdirAll(destPath, info.Mode().Perm()|0o700)
+		}
+
+		return copyFile(path, destPath, info)
+	})
+}
+
+func (localDir *LocalDir) Arch() (config.ConfigToolArch, error) {
+	if localDir.ArchName == "" {
+		return "", fmt.Errorf("no arch set for local dir target")
+	}
+	return localDir.ArchName, nil
+}
+
+func (localDir *LocalDir) Home(user string) (string, error) {
+	if home, ok := localDir.Homes[user]; ok {
+		return home, nil
+	}
+	if user == "root" {
+		return "/root", nil
+	}
+	return filepath.Join("/home", user), nil
+}
+
+func copyFile(src string, dest string, info fs.FileInfo) error {
+	if info.Mode()&fs.ModeSymlink != 0 {
+		linkTarget, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		os.Remove(dest)
+		return os.Symlink(linkTarget, dest)
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, srcFile)
+	return err
+}
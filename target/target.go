@@ -0,0 +1,108 @@
+package target
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/davidrios/nvim-mindevc/config"
+	"github.com/davidrios/nvim-mindevc/docker"
+)
+
+type CopyOptions struct {
+	FollowLink bool
+}
+
+// A Target is the environment where neovim gets installed, usually a
+// running devcontainer.
+type Target interface {
+	Exec(execParams docker.ExecParams) (string, error)
+	CopyTo(src string, dest string, options CopyOptions) error
+	// Copies src from the target to dest in the host.
+	CopyFrom(src string, dest string) error
+	Arch() (config.ConfigToolArch, error)
+	Home(user string) (string, error)
+}
+
+// Implemented by targets that can be started on demand.
+type Starter interface {
+	// Starts the target if it's not running and waits until it's ready.
+	// Returns whether it had to be started.
+	Start(timeout time.Duration) (bool, error)
+	Stop() error
+}
+
+func execArch(target Target) (config.ConfigToolArch, error) {
+	output, err := target.Exec(docker.ExecParams{
+		Args: []string{"uname", "-m"},
+		User: "root",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	arch := strings.TrimSpace(output)
+	slog.Debug("container arch", "v", arch)
+
+	return config.ConfigToolArch(arch), nil
+}
+
+func execHome(target Target, user string) (string, error) {
+	output, err := target.Exec(docker.ExecParams{
+		Args: []string{"sh", "-l", "-c", "echo $HOME"},
+		User: user,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting remote user home: %w", err)
+	}
+
+	home := strings.TrimSpace(output)
+	if home == "/" || home == "" {
+		return "", fmt.Errorf("error getting remote user home, got '%s'", home)
+	}
+
+	return home, nil
+}
+
+func FromDevcontainer(myConfig config.Config, devcontainer config.Devcontainer) (Target, error) {
+	cli, err := docker.GetCli(myConfig.Container.Cli, devcontainer.IsCompose())
+	if err != nil {
+		return nil, err
+	}
+
+	if devcontainer.IsCompose() {
+		if devcontainer.Spec.Service == "" {
+			return nil, fmt.Errorf("service property from devcontainer file must not be empty")
+		}
+
+		composeFile, err := docker.LoadComposeFile(devcontainer, cli)
+		if err != nil {
+			return nil, fmt.Errorf("error loading compose file: %w", err)
+		}
+		slog.Debug("composeFile", "v", composeFile)
+
+		serviceName := devcontainer.Spec.Service
+		if _, ok := composeFile.Spec.Services[serviceName]; !ok {
+			return nil, fmt.Errorf("compose file does not contain service '%s'", serviceName)
+		}
+
+		return &Compose{
+			File:        composeFile,
+			Service:     serviceName,
+			RunServices: devcontainer.Spec.RunServices,
+		}, nil
+	}
+
+	if devcontainer.Spec.Image == "" && devcontainer.Spec.Build.Dockerfile == "" {
+		return nil, fmt.Errorf("devcontainer file must have one of dockerComposeFile, image or build properties")
+	}
+
+	container, err := docker.FindContainer(devcontainer, cli)
+	if err != nil {
+		return nil, fmt.Errorf("error finding devcontainer: %w", err)
+	}
+	slog.Debug("container", "v", container)
+
+	return &Container{Container: container}, nil
+}
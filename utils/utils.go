@@ -5,11 +5,14 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 func DownloadFileHttp(rawUrl string, saveTo string) error {
@@ -66,6 +69,21 @@ func GetHashInFile(hashesFile string, fname string) (string, error) {
 	return "", fmt.Errorf("hash not found")
 }
 
+func Sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
 func FileContainsLine(fp io.Reader, lineToFind string) (bool, error) {
 	scanner := bufio.NewScanner(fp)
 	for scanner.Scan() {
@@ -82,6 +100,12 @@ func FileContainsLine(fp io.Reader, lineToFind string) (bool, error) {
 }
 
 func TarFolder(src string, dest string) error {
+	return TarPaths(src, []string{"."}, dest)
+}
+
+// Creates a tar file with only the given paths inside src, named relative to
+// src.
+func TarPaths(src string, paths []string, dest string) error {
 	outFile, err := os.Create(dest)
 	if err != nil {
 		return fmt.Errorf("failed to create destination file %s: %w", dest, err)
@@ -91,47 +115,116 @@ func TarFolder(src string, dest string) error {
 	tw := tar.NewWriter(outFile)
 	defer tw.Close()
 
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() && path == src {
-			return nil
-		}
+	for _, walkPath := range paths {
+		err := filepath.Walk(filepath.Join(src, walkPath), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-		relPath, err := filepath.Rel(src, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path for %s: %w", path, err)
-		}
+			relPath, err := filepath.Rel(src, path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path for %s: %w", path, err)
+			}
 
-		header, err := tar.FileInfoHeader(info, relPath)
-		if err != nil {
-			return fmt.Errorf("failed to create tar header for %s: %w", path, err)
-		}
-		header.Name = filepath.ToSlash(relPath)
+			if info.IsDir() && relPath == "." {
+				return nil
+			}
 
-		if err := tw.WriteHeader(header); err != nil {
-			return fmt.Errorf("failed to write tar header for %s: %w", path, err)
-		}
+			var link string
+			if info.Mode()&os.ModeSymlink != 0 {
+				link, err = os.Readlink(path)
+				if err != nil {
+					return fmt.Errorf("failed to read link %s: %w", path, err)
+				}
+			}
 
-		if !info.IsDir() {
-			fileToTar, err := os.Open(path)
+			header, err := tar.FileInfoHeader(info, link)
 			if err != nil {
-				return fmt.Errorf("failed to open file %s: %w", path, err)
+				return fmt.Errorf("failed to create tar header for %s: %w", path, err)
 			}
-			defer fileToTar.Close()
+			header.Name = filepath.ToSlash(relPath)
+
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to write tar header for %s: %w", path, err)
+			}
+
+			if info.Mode().IsRegular() {
+				fileToTar, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("failed to open file %s: %w", path, err)
+				}
+				defer fileToTar.Close()
 
-			if _, err := io.Copy(tw, fileToTar); err != nil {
-				return fmt.Errorf("failed to copy file content for %s: %w", path, err)
+				if _, err := io.Copy(tw, fileToTar); err != nil {
+					return fmt.Errorf("failed to copy file content for %s: %w", path, err)
+				}
 			}
+
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		return nil
-	})
+	return nil
+}
+
+// Joins the archive entry name to dest, failing if the result is outside of
+// dest, like with `../` components.
+func archiveEntryPath(dest string, name string) (string, error) {
+	target := filepath.Join(dest, name)
+	relPath, err := filepath.Rel(dest, target)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", fmt.Errorf("archive entry %s is outside of the destination", name)
+	}
+	return target, nil
+}
+
+// Checks that the link at linkPath to linkname points inside realDest, the
+// resolved destination. The parent of the link is resolved, so earlier links
+// can't be used to escape, and `..` is only allowed at the start of
+// linkname, where it's applied to a real folder.
+func checkArchiveLink(realDest string, linkPath string, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("archive link %s is absolute", linkPath)
+	}
+
+	parts := strings.Split(filepath.ToSlash(linkname), "/")
+	leading := 0
+	for leading < len(parts) && parts[leading] == ".." {
+		leading++
+	}
+	if slices.Contains(parts[leading:], "..") {
+		return fmt.Errorf("archive link %s has .. after the start", linkPath)
+	}
+
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	relPath, err := filepath.Rel(realDest, filepath.Join(realParent, linkname))
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return fmt.Errorf("archive link %s points outside of the destination", linkPath)
+	}
+	return nil
 }
 
 func ExtractTar(r io.Reader, dest string) error {
+	return ExtractTarStrip(r, dest, 0)
+}
+
+// Like ExtractTar, removing the first strip components from the file names
+// like `tar --strip-components`. Entries with fewer components are skipped.
+func ExtractTarStrip(r io.Reader, dest string, strip int) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+
 	tr := tar.NewReader(r)
 	for {
 		header, err := tr.Next()
@@ -142,7 +235,19 @@ func ExtractTar(r io.Reader, dest string) error {
 			return err
 		}
 
-		target := filepath.Join(dest, header.Name)
+		name := header.Name
+		if strip > 0 {
+			parts := strings.Split(strings.Trim(name, "/"), "/")
+			if len(parts) <= strip {
+				continue
+			}
+			name = strings.Join(parts[strip:], "/")
+		}
+
+		target, err := archiveEntryPath(dest, name)
+		if err != nil {
+			return err
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
@@ -158,9 +263,28 @@ func ExtractTar(r io.Reader, dest string) error {
 			if err != nil {
 				return err
 			}
-			defer f.Close()
 
-			if _, err := io.Copy(f, tr); err != nil {
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			// as links only point inside dest, the entries after them can't
+			// be written outside through them
+			if err := checkArchiveLink(realDest, target, header.Linkname); err != nil {
+				return err
+			}
+
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if err := os.Symlink(header.Linkname, target); err != nil {
 				return err
 			}
 		}
@@ -176,7 +300,10 @@ func extractZipFile(f *zip.File, destDir string) error {
 	}
 	defer rc.Close()
 
-	dest := filepath.Join(destDir, f.Name)
+	dest, err := archiveEntryPath(destDir, f.Name)
+	if err != nil {
+		return err
+	}
 
 	if f.FileInfo().IsDir() {
 		err = os.MkdirAll(dest, f.FileInfo().Mode())
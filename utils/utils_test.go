@@ -1,6 +1,11 @@
 package utils
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -54,3 +59,128 @@ test test`
 		})
 	}
 }
+
+func TestTarFolder_RoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "nvim"), []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nvim", filepath.Join(src, "bin", "vim")); err != nil {
+		t.Fatal(err)
+	}
+
+	tarFile := filepath.Join(t.TempDir(), "out.tar")
+	if err := TarFolder(src, tarFile); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fp, err := os.Open(tarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	dest := t.TempDir()
+	if err := ExtractTar(fp, dest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dest, "bin", "nvim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "binary" {
+		t.Fatalf("expected file content %q, got %q", "binary", content)
+	}
+
+	link, err := os.Readlink(filepath.Join(dest, "bin", "vim"))
+	if err != nil {
+		t.Fatalf("expected symlink: %s", err)
+	}
+	if link != "nvim" {
+		t.Fatalf("expected link target %q, got %q", "nvim", link)
+	}
+}
+
+func TestExtract_OutsideDestination(t *testing.T) {
+	testTable := []struct {
+		name    string
+		headers []tar.Header
+	}{
+		{name: "parent components", headers: []tar.Header{{Name: "x/../../evil", Typeflag: tar.TypeReg, Mode: 0o644}}},
+		{name: "absolute link", headers: []tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}},
+		{name: "relative link", headers: []tar.Header{{Name: "x/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}}},
+		{
+			name: "chained links",
+			headers: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+				{Name: "b/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+		},
+		{
+			name: "parent after linked folder",
+			headers: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "a/../outside"},
+				{Name: "b/evil", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+		},
+	}
+
+	for _, tv := range testTable {
+		t.Run(tv.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, header := range tv.headers {
+				if err := tw.WriteHeader(&header); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dest := filepath.Join(t.TempDir(), "dest")
+			// links can only be written through to existing folders
+			if err := os.MkdirAll(filepath.Join(filepath.Dir(dest), "outside"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ExtractTar(&buf, dest); err == nil {
+				t.Fatal("expected error for entry outside of the destination")
+			}
+			for _, outside := range []string{"evil", "outside/evil"} {
+				if _, err := os.Lstat(filepath.Join(filepath.Dir(dest), outside)); err == nil {
+					t.Fatalf("expected nothing written outside of the destination, found %s", outside)
+				}
+			}
+		})
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		zipFile := filepath.Join(t.TempDir(), "evil.zip")
+		fp, err := os.Create(zipFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(fp)
+		if _, err := zw.Create("../evil"); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fp.Close()
+
+		dest := filepath.Join(t.TempDir(), "dest")
+		if err := ExtractZip(zipFile, dest); err == nil {
+			t.Fatal("expected error for entry outside of the destination")
+		}
+		if _, err := os.Lstat(filepath.Join(filepath.Dir(dest), "evil")); err == nil {
+			t.Fatal("expected nothing written outside of the destination")
+		}
+	})
+}